@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// byteSizeUnits are the supported units of byte sizes, ordered so that longer suffixes are tried first.
+	byteSizeUnits = []struct {
+		suffix string
+		factor float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+)
+
+// ByteSize wraps a size in bytes, specified as a number with an optional unit (e.g. "512MiB", "20GB", or "1.5G").
+// Units are case-insensitive. Binary units ("KiB") and single letters ("K") are powers of 1024, decimal units
+// ("KB") are powers of 1000.
+type ByteSize struct {
+	Val int64
+}
+
+// String returns the wrapped byte size.
+func (bs ByteSize) String() string {
+	for _, u := range byteSizeUnits[:4] {
+		if (bs.Val >= int64(u.factor)) && (bs.Val%int64(u.factor) == 0) && (bs.Val/int64(u.factor) < 1024) {
+			return fmt.Sprintf("%d%s", bs.Val/int64(u.factor), u.suffix)
+		}
+	}
+
+	return strconv.FormatInt(bs.Val, 10)
+}
+
+// Set sets the wrapped byte size.
+func (bs *ByteSize) Set(v string) error {
+	v = strings.TrimSpace(v)
+
+	// Split off unit
+	factor := 1.0
+
+	for _, u := range byteSizeUnits {
+		if (len(v) > len(u.suffix)) && strings.EqualFold(v[len(v)-len(u.suffix):], u.suffix) {
+			v, factor = strings.TrimSpace(v[:len(v)-len(u.suffix)]), u.factor
+			break
+		}
+	}
+
+	// Parse number
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("parse byte size: %w", err)
+	}
+
+	if (n < 0) || (n*factor >= (1 << 63)) {
+		return errors.New("byte size out of range")
+	}
+
+	bs.Val = int64(n * factor)
+	return nil
+}
+
+// Type returns the name of the byte size type.
+func (*ByteSize) Type() string {
+	return "size"
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"testing"
+)
+
+// TestByteSizeSet tests parsing byte sizes.
+func TestByteSizeSet(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int64
+		wantErr bool
+	}{
+		{spec: "0", want: 0},
+		{spec: "1024", want: 1024},
+		{spec: "100B", want: 100},
+		{spec: "512KiB", want: 512 << 10},
+		{spec: "512MiB", want: 512 << 20},
+		{spec: "2GiB", want: 2 << 30},
+		{spec: "1TiB", want: 1 << 40},
+		{spec: "20KB", want: 20e3},
+		{spec: "20MB", want: 20e6},
+		{spec: "20GB", want: 20e9},
+		{spec: "2TB", want: 2e12},
+		{spec: "4K", want: 4 << 10},
+		{spec: "4M", want: 4 << 20},
+		{spec: "1.5G", want: 3 << 29},
+		{spec: "1T", want: 1 << 40},
+		{spec: "512mib", want: 512 << 20},
+		{spec: " 20 gb ", want: 20e9},
+		{spec: "0.5KB", want: 500},
+		{spec: "", wantErr: true},
+		{spec: "MiB", wantErr: true},
+		{spec: "ten", wantErr: true},
+		{spec: "10XB", wantErr: true},
+		{spec: "-1", wantErr: true},
+		{spec: "-1GiB", wantErr: true},
+		{spec: "8388608TiB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var bs ByteSize
+
+			err := bs.Set(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%q) error = %v, want error %t", tt.spec, err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (bs.Val != tt.want) {
+				t.Errorf("Set(%q) = %d, want %d", tt.spec, bs.Val, tt.want)
+			}
+		})
+	}
+}
+
+// TestByteSizeString tests formatting byte sizes, and that the result parses back to the same size.
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		val  int64
+		want string
+	}{
+		{val: 0, want: "0"},
+		{val: 1000, want: "1000"},
+		{val: 1024, want: "1KiB"},
+		{val: 1536, want: "1536"},
+		{val: 1023 << 10, want: "1023KiB"},
+		{val: 1 << 20, want: "1MiB"},
+		{val: 512 << 20, want: "512MiB"},
+		{val: 20 << 30, want: "20GiB"},
+		{val: 3 << 40, want: "3TiB"},
+		{val: 2048 << 40, want: "2251799813685248"},
+		{val: 20e9, want: "20000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			bs := ByteSize{Val: tt.val}
+
+			if got := bs.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			// Round trip
+			var parsed ByteSize
+
+			if err := parsed.Set(bs.String()); (err != nil) || (parsed != bs) {
+				t.Errorf("Set(%q) = %d, %v, want %d", bs.String(), parsed.Val, err, tt.val)
+			}
+		})
+	}
+}
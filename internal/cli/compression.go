@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/crissyfield/troll-a/pkg/fetch"
+)
+
+// Compression wraps a compression format.
+type Compression struct {
+	Val fetch.Compression
+}
+
+// String returns the wrapped compression format.
+func (c Compression) String() string {
+	return string(c.Val)
+}
+
+// Set sets the wrapped compression format.
+func (c *Compression) Set(s string) error {
+	val := fetch.Compression(strings.ToLower(s))
+
+	if !slices.Contains(fetch.Compressions, val) {
+		names := make([]string, len(fetch.Compressions))
+		for i, c := range fetch.Compressions {
+			names[i] = `"` + string(c) + `"`
+		}
+
+		return fmt.Errorf("must be one of %s, or %s", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+
+	c.Val = val
+	return nil
+}
+
+// Type returns the name of the compression format type.
+func (*Compression) Type() string {
+	return "compression"
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Journal records the WARC files that have been processed completely, one URL per line, so an interrupted scan
+// can be resumed by skipping them. It is safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]bool
+}
+
+// OpenJournal opens the journal at path, creating it if it doesn't exist yet.
+func OpenJournal(path string) (*Journal, error) {
+	done := make(map[string]bool)
+
+	// Read WARC files processed by previous runs
+	f, err := os.Open(path)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+
+		for scanner.Scan() {
+			if u := strings.TrimSpace(scanner.Text()); u != "" {
+				done[u] = true
+			}
+		}
+
+		err = scanner.Err()
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("read journal: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	// Open for appending
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	return &Journal{f: f, done: done}, nil
+}
+
+// Done returns true if the WARC file at URL u has been processed completely.
+func (j *Journal) Done(u string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.done[u]
+}
+
+// Add records the WARC file at URL u as processed completely.
+func (j *Journal) Add(u string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err := fmt.Fprintln(j.f, u)
+	if err == nil {
+		err = j.f.Sync()
+	}
+
+	if err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	j.done[u] = true
+	return nil
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
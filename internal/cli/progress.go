@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crissyfield/troll-a/pkg/fetch"
+)
+
+// Progress tracks the progress of scanning WARC files. All counters are safe for concurrent use.
+type Progress struct {
+	ArchivesTotal    int           // Number of WARC files to scan
+	ArchivesOpened   atomic.Int64  // Number of WARC files opened so far
+	ArchivesDone     atomic.Int64  // Number of WARC files finished (successfully or not)
+	BytesRead        atomic.Int64  // Number of (compressed) bytes read
+	BytesTotal       atomic.Int64  // Sum of the sizes of all opened WARC files, as far as known
+	SizeUnknown      atomic.Bool   // Set if the size of any opened WARC file is unknown
+	RecordsTraversed atomic.Uint64 // Number of WARC records traversed
+	RecordsScanned   atomic.Uint64 // Number of WARC records scanned for secrets
+	Findings         atomic.Uint64 // Number of secrets detected
+
+	start time.Time
+}
+
+// NewProgress creates a new progress tracker for scanning the given number of WARC files.
+func NewProgress(archives int) *Progress {
+	return &Progress{ArchivesTotal: archives, start: time.Now()}
+}
+
+// Open records the opening of a WARC file of the given size (or -1 if unknown), and returns a reader that
+// counts all bytes read from r. Random access (as used for seekable ZStd files) is retained, if supported by r.
+func (p *Progress) Open(r io.ReadCloser, size int64) io.ReadCloser {
+	p.ArchivesOpened.Add(1)
+
+	if size >= 0 {
+		p.BytesTotal.Add(size)
+	} else {
+		p.SizeUnknown.Store(true)
+	}
+
+	cr := &countingReader{r: r, count: &p.BytesRead}
+
+	if rsa, ok := r.(fetch.ReadSeekerAt); ok {
+		return &countingReadSeekerAt{countingReader: cr, rsa: rsa}
+	}
+
+	return cr
+}
+
+// Start reports the progress to STDERR periodically (either as text or as JSON events), until the returned
+// function is called, which reports one last time.
+func (p *Progress) Start(interval time.Duration, asJSON bool) func() {
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.Report(asJSON)
+
+			case <-done:
+				p.Report(asJSON)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Report outputs the current progress to STDERR, either as text or as a JSON event.
+func (p *Progress) Report(asJSON bool) {
+	elapsed := time.Since(p.start)
+
+	read := p.BytesRead.Load()
+	total := p.BytesTotal.Load()
+
+	// The total is only known once the sizes of all WARC files are known, until then the remaining time is
+	// estimated
+	throughput := float64(read) / max(elapsed.Seconds(), 0.001)
+	totalKnown := !p.SizeUnknown.Load() && (p.ArchivesOpened.Load() >= int64(p.ArchivesTotal))
+
+	eta := time.Duration(-1)
+	if estimated := p.estimateTotal(); (estimated >= 0) && (throughput > 0) {
+		eta = time.Duration(float64(max(estimated-read, 0)) / throughput * float64(time.Second))
+	}
+
+	if asJSON {
+		// JSON
+		out := map[string]any{
+			"event":             "progress",
+			"elapsed":           elapsed.Seconds(),
+			"archives_done":     p.ArchivesDone.Load(),
+			"archives_total":    p.ArchivesTotal,
+			"bytes_read":        read,
+			"bytes_per_second":  throughput,
+			"records_traversed": p.RecordsTraversed.Load(),
+			"records_scanned":   p.RecordsScanned.Load(),
+			"findings":          p.Findings.Load(),
+		}
+
+		if totalKnown {
+			out["bytes_total"] = total
+		}
+
+		if eta >= 0 {
+			out["eta"] = eta.Seconds()
+			out["eta_estimated"] = !totalKnown
+		}
+
+		_ = json.NewEncoder(os.Stderr).Encode(out)
+		return
+	}
+
+	// Terminal
+	var msg strings.Builder
+
+	fmt.Fprintf(&msg, "Progress: %s", formatBytes(read))
+
+	if totalKnown && (total > 0) {
+		fmt.Fprintf(&msg, " of %s (%.1f%%)", formatBytes(total), 100*float64(read)/float64(total))
+	}
+
+	fmt.Fprintf(
+		&msg,
+		", %d of %d WARC files, %d records (%d scanned), %d findings, %s/s",
+		p.ArchivesDone.Load(),
+		p.ArchivesTotal,
+		p.RecordsTraversed.Load(),
+		p.RecordsScanned.Load(),
+		p.Findings.Load(),
+		formatBytes(int64(throughput)),
+	)
+
+	if eta >= 0 {
+		approx := ""
+		if !totalKnown {
+			approx = "~"
+		}
+
+		fmt.Fprintf(&msg, ", ETA %s%s", approx, eta.Round(time.Second))
+	}
+
+	fmt.Fprintln(os.Stderr, InfoStyle.Render(msg.String()))
+}
+
+// estimateTotal returns the sum of the sizes of all WARC files, or -1 if it can't be estimated yet. Until all
+// WARC files are opened, the total is extrapolated from the average size of the opened ones, or (if sizes are
+// unknown) from the bytes read per finished WARC file.
+func (p *Progress) estimateTotal() int64 {
+	opened := p.ArchivesOpened.Load()
+	done := p.ArchivesDone.Load()
+	archives := int64(p.ArchivesTotal)
+
+	switch {
+	case !p.SizeUnknown.Load() && (opened >= archives):
+		return p.BytesTotal.Load()
+
+	case !p.SizeUnknown.Load() && (opened > 0):
+		return int64(float64(p.BytesTotal.Load()) * float64(archives) / float64(opened))
+
+	case done > 0:
+		return int64(float64(p.BytesRead.Load()) * float64(archives) / float64(done))
+
+	default:
+		return -1
+	}
+}
+
+// formatBytes formats a number of bytes using binary units (like "1.5 GiB").
+func formatBytes(n int64) string {
+	const units = "KMGTPE"
+
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v, i := float64(n)/1024, 0
+	for (v >= 1024) && (i < len(units)-1) {
+		v, i = v/1024, i+1
+	}
+
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
+
+// countingReader wraps a reader, counting all bytes read.
+type countingReader struct {
+	r     io.ReadCloser
+	count *atomic.Int64
+}
+
+// Read reads up to len(p) bytes into p.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.count.Add(int64(n))
+
+	return n, err
+}
+
+// Close closes the wrapped reader.
+func (cr *countingReader) Close() error {
+	return cr.r.Close()
+}
+
+// countingReadSeekerAt wraps a reader that allows random access, counting all bytes read.
+type countingReadSeekerAt struct {
+	*countingReader
+	rsa fetch.ReadSeekerAt
+}
+
+// ReadAt reads len(p) bytes into p, starting at offset off.
+func (cr *countingReadSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.rsa.ReadAt(p, off)
+	cr.count.Add(int64(n))
+
+	return n, err
+}
+
+// Seek sets the offset for the next read.
+func (cr *countingReadSeekerAt) Seek(offset int64, whence int) (int64, error) {
+	return cr.rsa.Seek(offset, whence)
+}
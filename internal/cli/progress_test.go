@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"testing"
+)
+
+// TestProgressEstimateTotal tests estimating the sum of the sizes of all WARC files.
+func TestProgressEstimateTotal(t *testing.T) {
+	tests := []struct {
+		name        string
+		archives    int
+		sizes       []int64 // Sizes of the opened WARC files (-1 if unknown)
+		done        int64
+		read        int64
+		want        int64
+		wantUnknown bool
+	}{
+		{name: "nothing opened", archives: 4, wantUnknown: true},
+		{name: "all opened", archives: 2, sizes: []int64{100, 300}, read: 50, want: 400},
+		{name: "some opened", archives: 4, sizes: []int64{100, 300}, read: 50, want: 800},
+		{name: "unknown sizes, nothing done", archives: 4, sizes: []int64{-1, 100}, read: 50, wantUnknown: true},
+		{name: "unknown sizes, some done", archives: 4, sizes: []int64{-1, 100}, done: 1, read: 150, want: 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProgress(tt.archives)
+
+			for _, size := range tt.sizes {
+				p.Open(nil, size)
+			}
+
+			p.ArchivesDone.Store(tt.done)
+			p.BytesRead.Store(tt.read)
+
+			got := p.estimateTotal()
+
+			if tt.wantUnknown {
+				if got >= 0 {
+					t.Errorf("estimateTotal() = %d, want unknown", got)
+				}
+
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("estimateTotal() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,72 +2,277 @@ package cli
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/crissyfield/troll-a/pkg/fetch"
 )
 
-var (
-	// BackoffStrategyValNone ...
-	RetryStrategyValNever = &backoff.StopBackOff{}
-
-	// RetryStrategyValConstant ...
-	RetryStrategyValConstant = backoff.WithMaxRetries(&backoff.ConstantBackOff{Interval: 5 * time.Second}, 5)
+// RetryStrategy wraps a retry strategy. The strategy is specified by its name, optionally followed by a colon
+// and a comma-separated list of parameters (e.g. "exponential:max-elapsed=2h,max-interval=1m").
+type RetryStrategy struct {
+	Val  func() backoff.BackOff // Creates a new instance of the retry strategy
+	spec string
+}
 
-	// RetryStrategyValExponential ...
-	RetryStrategyValExponential = backoff.NewExponentialBackOff()
+// MustParseRetryStrategy returns the retry strategy for the given specification. It panics if the
+// specification is invalid.
+func MustParseRetryStrategy(spec string) RetryStrategy {
+	var rs RetryStrategy
 
-	// RetryStrategyValAlways ...
-	RetryStrategyValAlways = &backoff.ZeroBackOff{}
-)
+	if err := rs.Set(spec); err != nil {
+		panic(err)
+	}
 
-// RetryStrategy wraps a retry strategy.
-type RetryStrategy struct {
-	Val backoff.BackOff
+	return rs
 }
 
 // String returns the wrapped retry strategy.
-func (bo RetryStrategy) String() string {
-	switch bo.Val {
-	case RetryStrategyValNever:
-		return "never"
-	case RetryStrategyValConstant:
-		return "constant"
-	case RetryStrategyValExponential:
-		return "exponential"
-	case RetryStrategyValAlways:
-		return "always"
-	}
-
-	return ""
+func (rs RetryStrategy) String() string {
+	return rs.spec
 }
 
 // Set sets the wrapped retry strategy.
-func (bo *RetryStrategy) Set(s string) error {
-	switch strings.ToLower(s) {
+func (rs *RetryStrategy) Set(s string) error {
+	// Split into name and parameters
+	name, rawParams, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	params, err := parseRetryParams(rawParams)
+	if err != nil {
+		return err
+	}
+
+	switch name {
 	case "never":
-		bo.Val = RetryStrategyValNever
-		return nil
+		err = rs.setNever(params)
 
 	case "constant":
-		bo.Val = RetryStrategyValConstant
-		return nil
+		err = rs.setConstant(params)
 
 	case "exponential":
-		bo.Val = RetryStrategyValExponential
-		return nil
+		err = rs.setExponential(params, 15*time.Minute)
 
 	case "always":
-		bo.Val = RetryStrategyValAlways
-		return nil
+		err = rs.setExponential(params, 0)
+
+	default:
+		// Invalid
+		return errors.New(`must be one of "never", "constant", "exponential", or "always"`)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s strategy: %w", name, err)
 	}
 
-	// Invalid
-	return errors.New(`must be one of "never", "constant", "exponential", or "always"`)
+	rs.spec = s
+	return nil
 }
 
 // Type returns the name of the backoff retry type.
 func (*RetryStrategy) Type() string {
 	return "retry-strategy"
 }
+
+// setNever sets a strategy that never retries.
+func (rs *RetryStrategy) setNever(params retryParams) error {
+	if err := params.check(); err != nil {
+		return err
+	}
+
+	rs.Val = func() backoff.BackOff { return &backoff.StopBackOff{} }
+	return nil
+}
+
+// setConstant sets a strategy that retries a limited number of times, with a constant delay.
+func (rs *RetryStrategy) setConstant(params retryParams) error {
+	if err := params.check("interval", "retries"); err != nil {
+		return err
+	}
+
+	interval, err := params.positiveDurationParam("interval", 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	retries, err := params.uintParam("retries", 5)
+	if err != nil {
+		return err
+	}
+
+	rs.Val = func() backoff.BackOff {
+		return fetch.WithMaxRetries(&backoff.ConstantBackOff{Interval: interval}, retries)
+	}
+
+	return nil
+}
+
+// setExponential sets a strategy that retries with an exponentially increasing delay. Retrying stops after
+// the maximum elapsed time, if not zero.
+func (rs *RetryStrategy) setExponential(params retryParams, maxElapsed time.Duration) error {
+	allowed := []string{"initial", "max-interval", "multiplier"}
+	if maxElapsed != 0 {
+		allowed = append(allowed, "max-elapsed", "retries")
+	}
+
+	if err := params.check(allowed...); err != nil {
+		return err
+	}
+
+	initial, err := params.positiveDurationParam("initial", backoff.DefaultInitialInterval)
+	if err != nil {
+		return err
+	}
+
+	maxInterval, err := params.positiveDurationParam("max-interval", backoff.DefaultMaxInterval)
+	if err != nil {
+		return err
+	}
+
+	multiplier, err := params.floatParam("multiplier", backoff.DefaultMultiplier)
+	if err != nil {
+		return err
+	}
+
+	if !(multiplier >= 1) {
+		return fmt.Errorf("parameter multiplier must be at least 1 [multiplier=%s]", params["multiplier"])
+	}
+
+	maxElapsed, err = params.durationParam("max-elapsed", maxElapsed)
+	if err != nil {
+		return err
+	}
+
+	if maxElapsed < 0 {
+		return fmt.Errorf("parameter max-elapsed must not be negative [max-elapsed=%s]", params["max-elapsed"])
+	}
+
+	retries, err := params.uintParam("retries", 0)
+	if err != nil {
+		return err
+	}
+
+	rs.Val = func() backoff.BackOff {
+		ebo := backoff.NewExponentialBackOff()
+
+		ebo.InitialInterval = initial
+		ebo.MaxInterval = maxInterval
+		ebo.Multiplier = multiplier
+		ebo.MaxElapsedTime = maxElapsed
+		ebo.Reset()
+
+		if retries > 0 {
+			return fetch.WithMaxRetries(ebo, retries)
+		}
+
+		return ebo
+	}
+
+	return nil
+}
+
+// retryParams wraps the parameters of a retry strategy.
+type retryParams map[string]string
+
+// parseRetryParams parses a comma-separated list of parameters (e.g. "interval=10s,retries=20").
+func parseRetryParams(s string) (retryParams, error) {
+	params := make(retryParams)
+
+	if s == "" {
+		return params, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf(`parameter must be of the form "key=value" [parameter=%s]`, kv)
+		}
+
+		params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return params, nil
+}
+
+// check returns an error if any parameter is not in the list of allowed parameters.
+func (p retryParams) check(allowed ...string) error {
+	for k := range p {
+		var ok bool
+
+		for _, a := range allowed {
+			ok = ok || (k == a)
+		}
+
+		if !ok {
+			if len(allowed) == 0 {
+				return fmt.Errorf("unknown parameter [parameter=%s]", k)
+			}
+
+			return fmt.Errorf("unknown parameter, must be one of %s [parameter=%s]", strings.Join(allowed, ", "), k)
+		}
+	}
+
+	return nil
+}
+
+// durationParam returns the parameter with the given key as duration, or def if not given.
+func (p retryParams) durationParam(key string, def time.Duration) (time.Duration, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("parse parameter %s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+// positiveDurationParam returns the parameter with the given key as positive duration, or def if not given.
+// Zero or negative delays would retry remote servers in a tight loop.
+func (p retryParams) positiveDurationParam(key string, def time.Duration) (time.Duration, error) {
+	d, err := p.durationParam(key, def)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("parameter %s must be positive [%s=%s]", key, key, p[key])
+	}
+
+	return d, nil
+}
+
+// uintParam returns the parameter with the given key as unsigned integer, or def if not given.
+func (p retryParams) uintParam(key string, def uint64) (uint64, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+
+	u, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse parameter %s: %w", key, err)
+	}
+
+	return u, nil
+}
+
+// floatParam returns the parameter with the given key as floating point number, or def if not given.
+func (p retryParams) floatParam(key string, def float64) (float64, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse parameter %s: %w", key, err)
+	}
+
+	return f, nil
+}
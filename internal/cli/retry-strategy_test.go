@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// TestRetryStrategySet tests parsing retry strategy specifications.
+func TestRetryStrategySet(t *testing.T) {
+	tests := []struct {
+		spec           string
+		wantErr        bool
+		wantRetries    int           // Number of retries before giving up, or -1 if unlimited
+		wantDelay      time.Duration // Delay between retries, if constant
+		wantMaxElapsed time.Duration // Maximum elapsed time, if not limited by retries
+	}{
+		{spec: "never", wantRetries: 0},
+		{spec: "constant", wantRetries: 5, wantDelay: 5 * time.Second},
+		{spec: "constant:interval=10s,retries=20", wantRetries: 20, wantDelay: 10 * time.Second},
+		{spec: " Constant: interval = 1m ", wantRetries: 5, wantDelay: time.Minute},
+		{spec: "exponential", wantRetries: -1, wantMaxElapsed: 15 * time.Minute},
+		{spec: "exponential:max-elapsed=2h,max-interval=1m", wantRetries: -1, wantMaxElapsed: 2 * time.Hour},
+		{spec: "exponential:retries=3,initial=1s,multiplier=2", wantRetries: 3},
+		{spec: "always", wantRetries: -1},
+		{spec: "always:initial=100ms", wantRetries: -1},
+		{spec: "sometimes", wantErr: true},
+		{spec: "never:retries=3", wantErr: true},
+		{spec: "constant:multiplier=2", wantErr: true},
+		{spec: "constant:interval", wantErr: true},
+		{spec: "constant:interval=soon", wantErr: true},
+		{spec: "constant:retries=-1", wantErr: true},
+		{spec: "exponential:multiplier=x", wantErr: true},
+		{spec: "always:max-elapsed=1h", wantErr: true},
+		{spec: "always:retries=3", wantErr: true},
+		{spec: "constant:interval=0", wantErr: true},
+		{spec: "constant:interval=-1s", wantErr: true},
+		{spec: "exponential:initial=0", wantErr: true},
+		{spec: "exponential:max-interval=-1m", wantErr: true},
+		{spec: "exponential:multiplier=0", wantErr: true},
+		{spec: "exponential:multiplier=-2", wantErr: true},
+		{spec: "exponential:multiplier=0.5", wantErr: true},
+		{spec: "exponential:multiplier=NaN", wantErr: true},
+		{spec: "exponential:max-elapsed=-1h", wantErr: true},
+		{spec: "always:initial=0s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var rs RetryStrategy
+
+			err := rs.Set(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%q) error = %v, want error %t", tt.spec, err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if rs.String() != tt.spec {
+				t.Errorf("String() = %q, want %q", rs.String(), tt.spec)
+			}
+
+			// Count retries (within a limit, as some strategies retry forever)
+			bo := rs.Val()
+			retries := 0
+
+			for ; retries < 100; retries++ {
+				d := bo.NextBackOff()
+				if d == backoff.Stop {
+					break
+				}
+
+				if (tt.wantDelay != 0) && (d != tt.wantDelay) {
+					t.Errorf("NextBackOff() = %s, want %s", d, tt.wantDelay)
+				}
+			}
+
+			if retries == 100 {
+				retries = -1
+			}
+
+			if retries != tt.wantRetries {
+				t.Errorf("strategy retries %d times, want %d", retries, tt.wantRetries)
+			}
+
+			if ebo, ok := rs.Val().(*backoff.ExponentialBackOff); ok && (ebo.MaxElapsedTime != tt.wantMaxElapsed) {
+				t.Errorf("MaxElapsedTime = %s, want %s", ebo.MaxElapsedTime, tt.wantMaxElapsed)
+			}
+		})
+	}
+}
+
+// TestRetryStrategyInstances tests that each instance of a retry strategy keeps its own state.
+func TestRetryStrategyInstances(t *testing.T) {
+	rs := MustParseRetryStrategy("constant:interval=1s,retries=1")
+
+	first, second := rs.Val(), rs.Val()
+
+	if d := first.NextBackOff(); d != time.Second {
+		t.Fatalf("NextBackOff() = %s, want %s", d, time.Second)
+	}
+
+	if d := first.NextBackOff(); d != backoff.Stop {
+		t.Errorf("NextBackOff() after last retry = %s, want stop", d)
+	}
+
+	if d := second.NextBackOff(); d != time.Second {
+		t.Errorf("NextBackOff() of new instance = %s, want %s", d, time.Second)
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shard wraps a shard of a list, specified as "i/n" (the i-th of n shards, starting at 1). Items are assigned
+// to shards round-robin, so multiple machines can split a list deterministically.
+type Shard struct {
+	Index uint // Index of the shard, starting at 1
+	Count uint // Number of shards
+}
+
+// String returns the wrapped shard.
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Set sets the wrapped shard.
+func (s *Shard) Set(v string) error {
+	// Split into index and count
+	rawIndex, rawCount, ok := strings.Cut(strings.TrimSpace(v), "/")
+	if !ok {
+		return errors.New(`must be of the form "i/n"`)
+	}
+
+	index, err := strconv.ParseUint(rawIndex, 10, 32)
+	if err != nil {
+		return fmt.Errorf("parse shard index: %w", err)
+	}
+
+	count, err := strconv.ParseUint(rawCount, 10, 32)
+	if err != nil {
+		return fmt.Errorf("parse shard count: %w", err)
+	}
+
+	if (count == 0) || (index == 0) || (index > count) {
+		return errors.New("shard index must be between 1 and the shard count")
+	}
+
+	s.Index, s.Count = uint(index), uint(count)
+	return nil
+}
+
+// Type returns the name of the shard type.
+func (*Shard) Type() string {
+	return "shard"
+}
+
+// Includes returns true if the item at position i (starting at 0) of a list belongs to the shard.
+func (s Shard) Includes(i int) bool {
+	return uint(i)%s.Count == s.Index-1
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"testing"
+)
+
+// TestShardSet tests parsing shard specifications.
+func TestShardSet(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Shard
+		wantErr bool
+	}{
+		{spec: "1/1", want: Shard{Index: 1, Count: 1}},
+		{spec: "3/8", want: Shard{Index: 3, Count: 8}},
+		{spec: " 8/8 ", want: Shard{Index: 8, Count: 8}},
+		{spec: "0/4", wantErr: true},
+		{spec: "5/4", wantErr: true},
+		{spec: "1/0", wantErr: true},
+		{spec: "-1/4", wantErr: true},
+		{spec: "1", wantErr: true},
+		{spec: "a/b", wantErr: true},
+		{spec: "1/4/2", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var s Shard
+
+			err := s.Set(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%q) error = %v, want error %t", tt.spec, err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if s != tt.want {
+				t.Errorf("Set(%q) = %v, want %v", tt.spec, s, tt.want)
+			}
+
+			if s.String() != (tt.want.String()) {
+				t.Errorf("String() = %q, want %q", s.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+// TestShardIncludes tests that shards split a list round-robin, with every item in exactly one shard.
+func TestShardIncludes(t *testing.T) {
+	tests := []struct {
+		shard Shard
+		items int
+		want  []int
+	}{
+		{shard: Shard{Index: 1, Count: 1}, items: 4, want: []int{0, 1, 2, 3}},
+		{shard: Shard{Index: 1, Count: 3}, items: 7, want: []int{0, 3, 6}},
+		{shard: Shard{Index: 3, Count: 3}, items: 7, want: []int{2, 5}},
+		{shard: Shard{Index: 5, Count: 8}, items: 4, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shard.String(), func(t *testing.T) {
+			var got []int
+
+			for i := 0; i < tt.items; i++ {
+				if tt.shard.Includes(i) {
+					got = append(got, i)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Includes() selected %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Includes() selected %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	// Every item is part of exactly one shard
+	for i := 0; i < 100; i++ {
+		n := 0
+
+		for s := uint(1); s <= 7; s++ {
+			if (Shard{Index: s, Count: 7}).Includes(i) {
+				n++
+			}
+		}
+
+		if n != 1 {
+			t.Errorf("item %d is part of %d of 7 shards, want 1", i, n)
+		}
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -27,43 +33,131 @@ var (
 	Version = "(unknown)"
 
 	// Configuration
-	configQuiet       = false
-	configJSON        = false
-	configJobs        = uint(8)
-	configEnclosed    = false
-	configTimeout     = 30 * time.Minute
-	configFilter      = ""
-	configRulesPreset = cli.RulesPreset{Val: preset.Secret}
-	configRulesCustom = []string{}
-	configRetry       = cli.RetryStrategy{Val: cli.RetryStrategyValNever}
+	configQuiet          = false
+	configJSON           = false
+	configJobs           = uint(8)
+	configEnclosed       = false
+	configTimeout        = time.Duration(0)
+	configConnectTimeout = 30 * time.Second
+	configHeaderTimeout  = 60 * time.Second
+	configIdleTimeout    = 60 * time.Second
+	configFilter         = ""
+	configRulesPreset    = cli.RulesPreset{Val: preset.Secret}
+	configRulesCustom    = []string{}
+	configRetry          = cli.MustParseRetryStrategy("never")
+	configS3Endpoint     = ""
+	configS3Region       = ""
+	configS3Profile      = ""
+	configS3RoleARN      = ""
+	configS3Anonymous    = false
+	configS3RequesterPay = false
+	configGCSEndpoint    = ""
+	configGCSAnonymous   = false
+	configAzureEndpoint  = ""
+	configAzureAccount   = ""
+	configAzureConnStr   = ""
+	configAzureSASToken  = ""
+	configIAEndpoint     = ""
+	configCCEndpoint     = ""
+	configSSHKey         = ""
+	configSSHKnownHosts  = ""
+	configLimit          = uint(0)
+	configJournal        = ""
+	configUserAgent      = ""
+	configHeaders        = []string{}
+	configUser           = ""
+	configBearerToken    = ""
+	configNetrc          = false
+	configNetrcFile      = ""
+	configProxy          = ""
+	configCABundle       = ""
+	configCert           = ""
+	configKey            = ""
+	configInputList      = ""
+	configBaseURL        = ""
+	configArchives       = uint(1)
+	configShard          = cli.Shard{Index: 1, Count: 1}
+	configCacheDir       = ""
+	configCacheSize      = cli.ByteSize{Val: 20 << 30}
+	configLimitRate      = cli.ByteSize{}
+	configConnections    = uint(1)
+	configProgress       = time.Duration(0)
+	configChecksum       = ""
+	configCompression    = cli.Compression{Val: fetch.CompressionAuto}
 )
 
 // buffer wraps the content and its target URI.
 type buffer struct {
+	Source    string // Address of the archive the content was read from
+	Member    string // Name of the member of the container the content was read from, if any
 	TargetURI string
 	Content   []byte
+	Paths     []string        // JSON path of each line, if content was extracted from JSON metadata
+	Part      *part           // Part of the multipart body, if content was extracted from one
+	Pending   *sync.WaitGroup // Marked as done once the buffer has been processed, if not nil
+}
+
+// done marks the buffer as processed.
+func (b *buffer) done() {
+	if b.Pending != nil {
+		b.Pending.Done()
+	}
+}
+
+// part identifies a single part of a multipart body.
+type part struct {
+	Index int
+	Name  string
 }
 
 // main is the main entry point of the command.
 func main() {
 	// Define command
 	var cmd = &cobra.Command{
-		Use: `troll-a [flags] [url]
+		Use: `troll-a [flags] [url...]
 
 This tool allows to extract (potential) secrets such as passwords, API keys, and tokens
 from WARC (Web ARChive) files. Extracted information is output as structured text org
 JSON, which simplifies further processing of the data.
 
 "url" can be either a regular HTTP or HTTPS reference ("https://domain/path"), an Amazon
-S3 reference ("s3://bucket/path"), a file path (either "file:///path" or simply "path"),
-or a dash ("-") to read from STDIN. If "url" is omitted data is read from STDIN. If the
-input data is compressed with either GZip, BZip2, XZ, or ZStd it is automatically
-decompressed. ZStd with a prepended custom dictionary (as used by "*.megawarc.warc.zstd")
-is also handled transparently.
+S3 reference ("s3://bucket/path"), a Google Cloud Storage reference
+("gs://bucket/path"), an Azure Blob Storage reference ("az://container/path" or
+"abfss://container@account.dfs.core.windows.net/path"), an Internet Archive reference
+("ia://item" or "ia://item/file"), a Common Crawl reference ("cc://CC-MAIN-2023-50",
+optionally followed by "/warc", "/wet", or "/wat"), an SFTP reference
+("sftp://user@host/path", authenticated by SSH key and checked against the known hosts),
+a file path (either "file:///path" or simply "path"), or a dash ("-") to read from
+STDIN. If "url" is omitted data is read from STDIN. Amazon S3 options can also be given
+as URL query parameters (e.g. "s3://commoncrawl/path?anonymous=true&region=us-east-1").
+Amazon S3 URLs ending with a slash and local directories are expanded to all WARC files
+below them, and Amazon S3 URLs or local paths containing glob patterns (e.g.
+"/data/crawls/**/*.warc.gz", with "**" matching any number of path segments, and "?"
+escaped as "%3F" in URLs) are expanded to all matching objects or files. Internet
+Archive items are expanded to all of their WARC files, or to those matching a glob
+pattern (e.g. "ia://item/*.megawarc.warc.zst"). Common Crawl crawls are expanded to all
+WARC files listed by their manifest (e.g. "warc.paths.gz"), optionally limited to a
+number of segments chosen at random (e.g.
+"cc://CC-MAIN-2023-50/wat?segments=10&seed=1"). All of them are then scanned in a single
+run, reporting the source of each detected secret. Multiple URLs can be given, either as
+arguments or with an input list (like the "warc.paths.gz" files of Common Crawl).
+Failing to process one WARC file does not stop the others, but is reported at the end.
+
+If the input data is compressed with either GZip, BZip2, XZ, ZStd, LZ4, or Snappy it is
+automatically decompressed. Brotli, which can't be detected by its content, is
+decompressed if the URL ends with ".br". ZStd with a prepended custom dictionary (as used
+by "*.megawarc.warc.zstd") is also handled transparently. Local ZStd files in the
+seekable format are decoded in parallel. Tar and Zip containers (possibly compressed, like
+"*.tar.gz") are read as a stream, scanning all WARC files within them and reporting the
+member each detected secret was found in.
+
+Besides HTTP responses, JSON metadata records (as found in WAT files) are checked as well,
+reporting the JSON path of each detected secret. Multipart HTTP responses are split into
+their parts, and only textual parts are checked.
 
 This tool uses rules from the Gitleaks project (https://gitleaks.io) to detect secrets.`,
 		Short:             "Drill into WARC web archives",
-		Args:              cobra.MaximumNArgs(1),
+		Args:              cobra.ArbitraryArgs,
 		Version:           Version,
 		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
 		Run:               runCommand,
@@ -73,8 +167,50 @@ This tool uses rules from the Gitleaks project (https://gitleaks.io) to detect s
 	cmd.Flags().BoolVarP(&configQuiet, "quiet", "q", configQuiet, `suppress success message(s)`)
 	cmd.Flags().BoolVarP(&configJSON, "json", "s", configJSON, `output detected secrets as JSON`)
 	cmd.Flags().UintVarP(&configJobs, "jobs", "j", configJobs, `detect secrets with this many concurrent jobs`)
+	cmd.Flags().UintVarP(&configArchives, "archives", "a", configArchives, `scan this many WARC files concurrently`)
+	cmd.Flags().StringVarP(&configInputList, "input-list", "i", configInputList, `read URLs from this file (or URL, or "-" for STDIN), one
+per line. The list may be compressed (e.g. "warc.paths.gz").`)
+	cmd.Flags().StringVarP(&configBaseURL, "base-url", "b", configBaseURL, `prefix for relative URLs of the input list (e.g.
+"https://data.commoncrawl.org/")`)
+	cmd.Flags().UintVar(&configLimit, "limit", configLimit, `only scan this many WARC files (of this shard, and not yet
+recorded in the journal). Zero means no limit.`)
+	cmd.Flags().StringVar(&configJournal, "journal", configJournal, `record WARC files that were processed completely in this
+file, and skip them when running again, so an interrupted
+scan can be resumed`)
+	cmd.Flags().Var(&configShard, "shard", `only scan the i-th of n shards of all WARC files ("i/n"),
+so multiple machines can split the work deterministically.
+WARC files are assigned to shards round-robin.`)
+	cmd.Flags().DurationVar(&configProgress, "progress", configProgress, `report progress (bytes read, records, findings, throughput,
+and ETA) to STDERR at this interval, as JSON events if
+--json/-s is given. Zero means no progress reports.`)
 	cmd.Flags().BoolVarP(&configEnclosed, "enclosed", "e", configEnclosed, `only report secrets that are enclosed within their context`)
-	cmd.Flags().DurationVarP(&configTimeout, "timeout", "t", configTimeout, `fetching timeout (does not apply to files)`)
+	cmd.Flags().DurationVarP(&configTimeout, "timeout", "t", configTimeout, `overall fetching timeout, including the transfer (does not
+apply to files). Zero means no timeout.`)
+	cmd.Flags().DurationVar(&configConnectTimeout, "connect-timeout", configConnectTimeout, `timeout for establishing a connection`)
+	cmd.Flags().DurationVar(&configHeaderTimeout, "header-timeout", configHeaderTimeout, `timeout for receiving the response header`)
+	cmd.Flags().DurationVar(&configIdleTimeout, "idle-timeout", configIdleTimeout, `timeout after which a transfer that did not receive any
+data is considered stalled, and is resumed according to the
+retry strategy. Zero means no timeout.`)
+	cmd.Flags().UintVar(&configConnections, "connections", configConnections, `download each WARC file using this many concurrent range
+requests, if supported by the server. Needs up to 16 MiB of
+memory per connection.`)
+	cmd.Flags().Var(&configLimitRate, "limit-rate", `maximum combined bandwidth of all downloads per second (e.g.
+"10MiB" or "100MB"). Zero means no limit.`)
+	cmd.Flags().StringVar(&configCacheDir, "cache-dir", configCacheDir, `cache downloaded WARC files in this directory, so repeated
+scans of the same (unchanged) files don't download them again`)
+	cmd.Flags().Var(&configCacheSize, "cache-size", `maximum size of the cache (e.g. "500MiB" or "100GB"). The
+least recently used files are evicted first. Zero means no
+limit.`)
+	cmd.Flags().StringVar(&configChecksum, "checksum", configChecksum, `verify each WARC file against a checksum while scanning it.
+This is either an explicit checksum ("algorithm:digest", e.g.
+"sha256:e3b0c442...", for a single WARC file only), or "auto"
+to take it from S3/GCS object metadata, sidecar files (e.g.
+"example.warc.gz.sha256"), or Internet Archive item metadata.
+Supported algorithms are sha512, sha256, sha1, and md5.`)
+	cmd.Flags().Var(&configCompression, "compression", `compression format of the WARC files, in case detection by
+magic bytes (or the ".br" extension for Brotli) fails. This
+could be "auto", "none", "gzip", "bzip2", "xz", "zstd",
+"brotli", "lz4", or "snappy".`)
 
 	cmd.Flags().StringVarP(&configFilter, "filter", "f", configFilter, `filter for the target URL of each WARC record. Only WARC
 records that match the given regular expression (using RE2
@@ -103,12 +239,81 @@ never:       This strategy will fail after the first fetch
              failure and will not attempt to retry.
 constant:    This strategy will attempt to retry up to 5
              times, with a 5s delay after each attempt.
+             Parameters: interval, retries.
 exponential: This strategy will attempt to retry for 15
              minutes, with an exponentially increasing
-             delay after each attempt.
+             delay after each attempt. Parameters: initial,
+             max-interval, max-elapsed, multiplier, retries.
 always:      This strategy will attempt to retry forever,
-             with no delay at all after each attempt.
-No other values are allowed.`)
+             with an exponentially increasing delay (of at
+             most 1m) after each attempt. Parameters:
+             initial, max-interval, multiplier.
+No other values are allowed. Parameters can be appended to
+override their defaults, e.g. "constant:interval=10s,retries=20"
+or "exponential:max-elapsed=2h,max-interval=1m". Permanent
+errors (like 403 or 404) are never retried, and delays
+requested by the server (via Retry-After) are honored, unless
+they exceed 15m or the remaining max-elapsed time. The
+strategy also applies to resuming downloads that got
+interrupted.`)
+
+	cmd.Flags().StringVarP(&configUserAgent, "user-agent", "A", configUserAgent, `User-Agent header of HTTP requests (default
+"troll-a/<version>")`)
+	cmd.Flags().StringArrayVarP(&configHeaders, "header", "H", nil, `additional header for HTTP/HTTPS requests ("Name: Value").
+Can be given multiple times.`)
+	cmd.Flags().StringVarP(&configUser, "user", "u", configUser, `user name and password for HTTP/HTTPS basic authentication
+("user:password")`)
+	cmd.Flags().StringVar(&configBearerToken, "bearer-token", configBearerToken, `bearer token for HTTP/HTTPS authentication`)
+	cmd.Flags().BoolVar(&configNetrc, "netrc", configNetrc, `take credentials for HTTP/HTTPS authentication from the
+netrc file ($NETRC, or "~/.netrc")`)
+	cmd.Flags().StringVar(&configNetrcFile, "netrc-file", configNetrcFile, `take credentials for HTTP/HTTPS authentication from this
+netrc file`)
+	cmd.Flags().StringVar(&configProxy, "proxy", configProxy, `proxy URL for all requests. Defaults to the HTTP_PROXY,
+HTTPS_PROXY, and NO_PROXY environment variables.`)
+	cmd.Flags().StringVar(&configCABundle, "cacert", configCABundle, `PEM file with additional CA certificates to trust`)
+	cmd.Flags().StringVar(&configCert, "cert", configCert, `PEM file with the client certificate for mutual TLS`)
+	cmd.Flags().StringVar(&configKey, "key", configKey, `PEM file with the key of the client certificate (if not
+part of the certificate file)`)
+
+	cmd.Flags().StringVar(&configS3Endpoint, "s3-endpoint", configS3Endpoint, `custom Amazon S3 endpoint (e.g. "http://localhost:9000" for
+MinIO or Ceph), accessed using path-style addressing`)
+	cmd.Flags().StringVar(&configS3Region, "s3-region", configS3Region, `Amazon S3 region. Defaults to the region of the AWS
+configuration, or to "us-east-1".`)
+	cmd.Flags().StringVar(&configS3Profile, "s3-profile", configS3Profile, `profile of the shared AWS configuration to use`)
+	cmd.Flags().StringVar(&configS3RoleARN, "s3-role-arn", configS3RoleARN, `ARN of an IAM role to assume for accessing Amazon S3`)
+	cmd.Flags().BoolVar(&configS3Anonymous, "s3-anonymous", configS3Anonymous, `access Amazon S3 with unsigned requests (for public buckets
+like "commoncrawl")`)
+	cmd.Flags().BoolVar(&configS3RequesterPay, "s3-requester-pays", configS3RequesterPay, `agree to pay for accessing requester-pays buckets`)
+
+	cmd.Flags().StringVar(&configGCSEndpoint, "gcs-endpoint", configGCSEndpoint, `endpoint of the Google Cloud Storage JSON API (e.g. for a
+local fake-gcs-server). Defaults to the STORAGE_EMULATOR_HOST
+environment variable, if set, or to the official endpoint.`)
+	cmd.Flags().BoolVar(&configGCSAnonymous, "gcs-anonymous", configGCSAnonymous, `access Google Cloud Storage anonymously (for public buckets),
+instead of using application default credentials`)
+
+	cmd.Flags().StringVar(&configAzureEndpoint, "azure-endpoint", configAzureEndpoint, `Azure Blob Storage endpoint, including the account name for
+path-style endpoints (e.g. "http://127.0.0.1:10000/devstoreaccount1"
+for a local Azurite). Defaults to the endpoint of the account.`)
+	cmd.Flags().StringVar(&configAzureAccount, "azure-account", configAzureAccount, `Azure Storage account name. Defaults to the
+AZURE_STORAGE_ACCOUNT environment variable.`)
+	cmd.Flags().StringVar(&configAzureConnStr, "azure-connection-string", configAzureConnStr, `Azure Storage connection string, providing endpoint and
+credentials. Defaults to the AZURE_STORAGE_CONNECTION_STRING
+environment variable, which should be preferred to keep the
+credentials out of the process list.`)
+	cmd.Flags().StringVar(&configAzureSASToken, "azure-sas-token", configAzureSASToken, `Azure Storage SAS token. Defaults to the
+AZURE_STORAGE_SAS_TOKEN environment variable. Without SAS token
+or account key (AZURE_STORAGE_KEY), access is anonymous.`)
+
+	cmd.Flags().StringVar(&configIAEndpoint, "ia-endpoint", configIAEndpoint, `Internet Archive endpoint for "ia://" URLs and item metadata
+(e.g. for a local mirror). Defaults to "https://archive.org".`)
+	cmd.Flags().StringVar(&configCCEndpoint, "cc-endpoint", configCCEndpoint, `Common Crawl endpoint for "cc://" URLs, prepended to the
+paths of the manifest and all WARC files (e.g. "s3://commoncrawl",
+or a local directory mirroring the crawl data). Defaults to
+"https://data.commoncrawl.org".`)
+	cmd.Flags().StringVar(&configSSHKey, "ssh-key", configSSHKey, `private key file for "sftp://" URLs. Defaults to
+"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", or "~/.ssh/id_rsa".`)
+	cmd.Flags().StringVar(&configSSHKnownHosts, "ssh-known-hosts", configSSHKnownHosts, `known hosts file the host keys of "sftp://" servers are
+checked against. Defaults to "~/.ssh/known_hosts".`)
 
 	// Version should include regular expression engine
 	cmd.SetVersionTemplate(`{{printf "%s version %s" .Name .Version}}-` + detect.AbstractRegexpEngine)
@@ -122,6 +327,15 @@ No other values are allowed.`)
 
 // runCommand is called when the command is used.
 func runCommand(_ *cobra.Command, args []string) {
+	// Cancel everything on the first interrupt, and terminate right away on the second one
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Create detector on given rules preset
 	detector, err := detect.NewDetector(configRulesPreset.Val, configRulesCustom, configEnclosed)
 	if err != nil {
@@ -142,115 +356,489 @@ func runCommand(_ *cobra.Command, args []string) {
 		filter = f
 	}
 
-	// Read from STDIN if no parameter is given
-	var inputURL string
-
-	if len(args) > 0 {
-		inputURL = args[0]
+	// Fetching options
+	opts, err := httpOptions()
+	if err != nil {
+		cli.Error(`Error: Invalid HTTP option ["%s"]`, err)
+		os.Exit(1) //nolint
 	}
 
-	// Open reader for URL
-	fr, err := fetch.Open(
-		inputURL,
+	opts = append(
+		opts,
 		fetch.WithTimeout(configTimeout),
-		fetch.WithBackoff(configRetry.Val),
+		fetch.WithConnectTimeout(configConnectTimeout),
+		fetch.WithHeaderTimeout(configHeaderTimeout),
+		fetch.WithIdleTimeout(configIdleTimeout),
+		fetch.WithBackoffFunc(configRetry.Val),
+		fetch.WithConnections(int(configConnections)),
+		fetch.WithCache(configCacheDir, configCacheSize.Val),
+		fetch.WithS3Endpoint(configS3Endpoint),
+		fetch.WithS3Region(configS3Region),
+		fetch.WithS3Profile(configS3Profile),
+		fetch.WithS3RoleARN(configS3RoleARN),
+		fetch.WithS3Anonymous(configS3Anonymous),
+		fetch.WithS3RequesterPays(configS3RequesterPay),
+		fetch.WithGCSEndpoint(configGCSEndpoint),
+		fetch.WithGCSAnonymous(configGCSAnonymous),
+		fetch.WithAzureEndpoint(configAzureEndpoint),
+		fetch.WithAzureAccount(configAzureAccount),
+		fetch.WithAzureConnectionString(configAzureConnStr),
+		fetch.WithAzureSASToken(configAzureSASToken),
+		fetch.WithIAEndpoint(configIAEndpoint),
+		fetch.WithCCEndpoint(configCCEndpoint),
+		fetch.WithSSHKeyFile(configSSHKey),
+		fetch.WithSSHKnownHostsFile(configSSHKnownHosts),
 	)
 
-	if err != nil {
-		cli.Error(`Error: Failed to fetch WARC file ["%s"]`, err)
-		os.Exit(1) //nolint
+	// Share a single rate limiter among all downloads
+	if configLimitRate.Val > 0 {
+		opts = append(opts, fetch.WithRateLimiter(fetch.NewRateLimiter(configLimitRate.Val)))
 	}
 
-	defer fr.Close()
+	// Collect URLs from arguments and input list, read from STDIN if none is given
+	inputURLs := args
 
-	// Decompress, if necessary
-	dr, err := fetch.NewDecompressionReader(fr)
-	if err != nil {
-		cli.Error(`Error: Failed to decompress WARC file ["%s"]`, err)
+	if configInputList != "" {
+		list, err := readInputList(ctx, configInputList, configBaseURL, opts)
+		if err != nil {
+			cli.Error(`Error: Failed to read input list ["%s"]`, err)
+			os.Exit(1) //nolint
+		}
+
+		inputURLs = append(inputURLs, list...)
+	} else if len(inputURLs) == 0 {
+		inputURLs = []string{""}
+	}
+
+	// Expand URLs into archives (e.g. for prefixes or glob patterns), keeping only those of our shard
+	var archiveURLs []string
+	var archiveCount int
+
+	for _, u := range inputURLs {
+		us, err := fetch.Expand(ctx, u, opts...)
+		if err != nil {
+			cli.Error(`Error: Failed to expand URL ["%s"]`, err)
+			os.Exit(1) //nolint
+		}
+
+		for _, au := range us {
+			if configShard.Includes(archiveCount) {
+				archiveURLs = append(archiveURLs, au)
+			}
+
+			archiveCount++
+		}
+	}
+
+	if len(archiveURLs) == 0 {
+		cli.Error(`Error: No WARC files found`)
 		os.Exit(1) //nolint
 	}
 
-	defer dr.Close()
+	// Skip WARC files processed by previous runs, if requested
+	var journal *cli.Journal
+
+	if configJournal != "" {
+		journal, err = cli.OpenJournal(configJournal)
+		if err != nil {
+			cli.Error(`Error: Failed to open journal ["%s"]`, err)
+			os.Exit(1) //nolint
+		}
+
+		defer journal.Close()
+
+		var pendingURLs []string
+
+		for _, u := range archiveURLs {
+			if !journal.Done(u) {
+				pendingURLs = append(pendingURLs, u)
+			}
+		}
+
+		if len(pendingURLs) == 0 {
+			if !configQuiet {
+				cli.Success("Success: All %d WARC files have already been processed", len(archiveURLs))
+			}
+
+			return
+		}
+
+		archiveURLs = pendingURLs
+	}
+
+	// Limit number of WARC files, if requested
+	if (configLimit > 0) && (uint(len(archiveURLs)) > configLimit) {
+		archiveURLs = archiveURLs[:configLimit]
+	}
+
+	// Verify archives (but not the input list) against checksums, if requested
+	if configChecksum != "" {
+		if (configChecksum != fetch.ChecksumAuto) && (len(archiveURLs) > 1) {
+			cli.Error(`Error: An explicit checksum can only be used with a single WARC file`)
+			os.Exit(1) //nolint
+		}
+
+		opts = append(opts, fetch.WithChecksum(configChecksum))
+	}
+
+	// Track progress, reporting it periodically if requested
+	progress := cli.NewProgress(len(archiveURLs))
+	stopProgress := func() {}
+
+	if configProgress > 0 {
+		stopProgress = progress.Start(configProgress, configJSON)
+	}
 
 	// Channel for communication between WARC traversal and secret detection
 	bufferCh := make(chan *buffer)
 
-	// Spawn go routines to check buffers for secrets
-	eg, ctx := errgroup.WithContext(context.Background())
+	// Spawn go routines to check buffers for secrets, shared by all archives
+	eg, ectx := errgroup.WithContext(ctx)
 
 	for j := uint(0); j < configJobs; j++ {
-		eg.Go(NewSecretsDetectorFunc(bufferCh, detector, configJSON))
+		eg.Go(NewSecretsDetectorFunc(ectx, bufferCh, detector, configJSON, len(archiveURLs) > 1, progress))
 	}
 
-	// Traverse WARC file
-	var recordCount atomic.Uint64
+	// Process archives, some of them concurrently. Failed archives are reported, but don't stop the others.
+	var ag errgroup.Group
+	var failedCount atomic.Uint64
 
-	err = warc.Traverse(dr, NewWARCTraversalFunc(ctx.Done(), filter, bufferCh, &recordCount))
-	if err != nil {
-		cli.Error(`Error: Failed to process WARC file ["%s"]`, err)
-		os.Exit(1) //nolint
+	ag.SetLimit(int(max(configArchives, 1)))
+
+	for _, u := range archiveURLs {
+		// Stop early if secret detection failed or if interrupted
+		if ectx.Err() != nil {
+			break
+		}
+
+		ag.Go(func() error {
+			recordCount, err := processArchive(ectx, u, opts, configCompression.Val, filter, bufferCh, progress, configChecksum != "")
+			progress.ArchivesDone.Add(1)
+
+			if err != nil {
+				// Don't report each archive if interrupted
+				if ctx.Err() == nil {
+					cli.Error(`Error: Failed to process WARC file %s ["%s"]`, u, err)
+				}
+
+				failedCount.Add(1)
+				return nil
+			}
+
+			// Record in journal, if requested
+			if journal != nil {
+				err = journal.Add(u)
+				if err != nil {
+					cli.Error(`Error: Failed to record WARC file %s ["%s"]`, u, err)
+					failedCount.Add(1)
+
+					return nil
+				}
+			}
+
+			// Dump success message
+			if !configQuiet {
+				cli.Success("Success: Processed %s (%d records)", u, recordCount)
+			}
+
+			return nil
+		})
 	}
 
+	_ = ag.Wait()
+
 	// Clean up
 	close(bufferCh)
 
 	err = eg.Wait()
+	stopProgress()
+
+	if ctx.Err() != nil {
+		cli.Error(`Error: Interrupted`)
+		os.Exit(130) //nolint
+	}
+
 	if err != nil {
 		cli.Error(`Error: Failed to detect secrets ["%s"]`, err)
 		os.Exit(1) //nolint
 	}
 
-	// Dump success message
-	if !configQuiet {
-		cli.Success("Success: Processed %s (%d records)", inputURL, recordCount.Load())
+	// Dump summary
+	if failedCount.Load() > 0 {
+		if len(archiveURLs) > 1 {
+			cli.Error(`Error: Failed to process %d of %d WARC files`, failedCount.Load(), len(archiveURLs))
+		}
+
+		os.Exit(1) //nolint
+	}
+
+	if !configQuiet && (len(archiveURLs) > 1) {
+		cli.Success("Success: Processed %d WARC files", len(archiveURLs))
 	}
 }
 
+// httpOptions returns the fetching options for HTTP requests.
+func httpOptions() ([]fetch.Option, error) {
+	userAgent := configUserAgent
+	if userAgent == "" {
+		userAgent = "troll-a/" + Version + " (+https://github.com/crissyfield/troll-a)"
+	}
+
+	opts := []fetch.Option{
+		fetch.WithUserAgent(userAgent),
+		fetch.WithProxy(configProxy),
+		fetch.WithCABundle(configCABundle),
+		fetch.WithClientCertificate(configCert, configKey),
+		fetch.WithBearerToken(configBearerToken),
+	}
+
+	// Headers
+	for _, h := range configHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || (strings.TrimSpace(name) == "") {
+			return nil, fmt.Errorf(`header must be of the form "Name: Value" [header=%s]`, h)
+		}
+
+		opts = append(opts, fetch.WithHeader(strings.TrimSpace(name), strings.TrimSpace(value)))
+	}
+
+	// Basic authentication
+	if configUser != "" {
+		user, password, _ := strings.Cut(configUser, ":")
+		opts = append(opts, fetch.WithBasicAuth(user, password))
+	}
+
+	// Netrc file
+	netrcFile := configNetrcFile
+
+	if configNetrc && (netrcFile == "") {
+		netrcFile = os.Getenv("NETRC")
+
+		if netrcFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("find netrc file: %w", err)
+			}
+
+			netrcFile = filepath.Join(home, ".netrc")
+		}
+	}
+
+	if netrcFile != "" {
+		opts = append(opts, fetch.WithNetrc(netrcFile))
+	}
+
+	return opts, nil
+}
+
+// readInputList reads the list of URLs at addr (one per line, possibly compressed), prepending base to all
+// relative URLs. Empty lines and comments (starting with "#") are skipped.
+func readInputList(ctx context.Context, addr string, base string, opts []fetch.Option) ([]string, error) {
+	// Open reader for URL
+	fr, err := fetch.Open(ctx, addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+
+	defer fr.Close()
+
+	// Decompress, if necessary
+	dr, err := fetch.NewDecompressionReader(fr, fetch.WithFileName(addr))
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	defer dr.Close()
+
+	// Read URLs line by line
+	var urls []string
+
+	scanner := bufio.NewScanner(dr)
+
+	for scanner.Scan() {
+		u := strings.TrimSpace(scanner.Text())
+		if (u == "") || strings.HasPrefix(u, "#") {
+			continue
+		}
+
+		if (base != "") && !strings.Contains(u, "://") {
+			u = strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(u, "/")
+		}
+
+		urls = append(urls, u)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	return urls, nil
+}
+
+// processArchive fetches the archive at inputURL, traverses it, and hands all relevant records over to channel
+// out. It returns once all records have been processed (or the context is canceled), and returns the number of
+// records. The archive is decompressed using the given compression format (unless CompressionAuto). Bytes and
+// records are counted in progress. If verify is set, the archive is read up to its very end after traversal, so
+// its checksum gets verified.
+func processArchive(ctx context.Context, inputURL string, opts []fetch.Option, compression fetch.Compression, filter detect.AbstractRegexp, out chan<- *buffer, progress *cli.Progress, verify bool) (uint64, error) {
+	// Open reader for URL
+	fr, err := fetch.Open(ctx, inputURL, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("fetch: %w", err)
+	}
+
+	defer fr.Close()
+
+	// Decompress, if necessary, counting the bytes read
+	cr := progress.Open(fr, fetch.Size(fr))
+
+	dr, err := fetch.NewDecompressionReader(cr, fetch.WithCompression(compression), fetch.WithFileName(inputURL))
+	if err != nil {
+		return 0, fmt.Errorf("decompress: %w", err)
+	}
+
+	defer dr.Close()
+
+	// Traverse WARC file (or each WARC file within a tar or Zip container), waiting for all records to be processed
+	var recordCount atomic.Uint64
+	var pending sync.WaitGroup
+
+	err = fetch.WalkContainer(ctx, dr, func(member string, r io.Reader) error {
+		// Decompress member, if necessary
+		if member != "" {
+			mr, err := fetch.NewDecompressionReader(io.NopCloser(r), fetch.WithFileName(member))
+			if err != nil {
+				return fmt.Errorf("decompress: %w", err)
+			}
+
+			defer mr.Close()
+
+			r = mr
+		}
+
+		traverse := NewWARCTraversalFunc(ctx.Done(), filter, inputURL, member, out, &recordCount, &pending)
+
+		return warc.Traverse(ctx, r, func(r *warc.Record) error {
+			progress.RecordsTraversed.Add(1)
+
+			before := recordCount.Load()
+			err := traverse(r)
+
+			if recordCount.Load() > before {
+				progress.RecordsScanned.Add(1)
+			}
+
+			return err
+		}, warc.WithAllRecords())
+	})
+
+	pending.Wait()
+
+	if err != nil {
+		return 0, fmt.Errorf("traverse: %w", err)
+	}
+
+	// Read remainder (like trailing padding), which is required to verify the checksum
+	if verify {
+		_, err = io.Copy(io.Discard, cr)
+		if err != nil {
+			return 0, fmt.Errorf("verify: %w", err)
+		}
+	}
+
+	return recordCount.Load(), nil
+}
+
 // NewSecretsDetectorFunc returns a new function that reads buffers from channel in and processes them using
-// the given detector. If asJSON is set found secrets will be written to STDOUT in JSON format, otherwise found
-// secrets will be written semi-structured to STDOUT.
-func NewSecretsDetectorFunc(in <-chan *buffer, detector *detect.Detector, asJSON bool) func() error {
+// the given detector, until the context is canceled. If asJSON is set found secrets will be written to STDOUT in
+// JSON format, otherwise found secrets will be written semi-structured to STDOUT. If withSource is set,
+// semi-structured output includes the archive each secret was found in (JSON output always does). Found
+// secrets are counted in progress.
+func NewSecretsDetectorFunc(ctx context.Context, in <-chan *buffer, detector *detect.Detector, asJSON bool, withSource bool, progress *cli.Progress) func() error {
 	return func() error {
 		// Read next buffer
 		for b := range in {
 			// Detect secrets
-			findings, err := detector.Detect(bytes.NewBuffer(b.Content))
+			findings, err := detector.Detect(ctx, bytes.NewBuffer(b.Content))
 			if err != nil {
+				b.done()
 				return fmt.Errorf("detect secrets: %w", err)
 			}
 
+			progress.Findings.Add(uint64(len(findings)))
+
 			for _, f := range findings {
 				// Print findings
 				if asJSON {
 					// JSON
-					_ = json.NewEncoder(os.Stdout).Encode(map[string]any{
+					out := map[string]any{
 						"secret":  f.Secret,
 						"rule":    f.RuleID,
 						"uri":     b.TargetURI,
 						"line":    f.Location.StartLine,
 						"column":  f.Location.StartColumn,
 						"context": f.Location.Line(string(b.Content)),
-					})
+						"source":  b.Source,
+					}
+
+					if b.Member != "" {
+						out["member"] = b.Member
+					}
+
+					if b.Paths != nil {
+						out["path"] = b.Paths[f.Location.StartLine]
+					}
+
+					if b.Part != nil {
+						out["part"] = b.Part.Index
+						out["part_name"] = b.Part.Name
+					}
+
+					_ = json.NewEncoder(os.Stdout).Encode(out)
 				} else {
 					// Terminal
+					var extra string
+
+					if withSource {
+						extra += fmt.Sprintf(` source="%s"`, b.Source)
+					}
+
+					if b.Member != "" {
+						extra += fmt.Sprintf(` member="%s"`, b.Member)
+					}
+
+					if b.Paths != nil {
+						extra += fmt.Sprintf(` path="%s"`, b.Paths[f.Location.StartLine])
+					}
+
+					if b.Part != nil {
+						extra += fmt.Sprintf(` part=%d part_name="%s"`, b.Part.Index, b.Part.Name)
+					}
+
 					cli.Info(
-						`Detected: secret="%s" rule="%s" uri="%s" line=%d column=%d`,
+						`Detected: secret="%s" rule="%s" uri="%s" line=%d column=%d%s`,
 						f.Secret,
 						f.RuleID,
 						b.TargetURI,
 						f.Location.StartLine,
 						f.Location.StartColumn,
+						extra,
 					)
 				}
 			}
+
+			b.done()
 		}
 
 		return nil
 	}
 }
 
-// NewWARCTraversalFunc ...
-func NewWARCTraversalFunc(done <-chan struct{}, filter detect.AbstractRegexp, out chan<- *buffer, count *atomic.Uint64) func(*warc.Record) error {
+// NewWARCTraversalFunc returns a new function that hands the content of all relevant WARC records over to channel
+// out, tagged with the address of the source archive and the name of the container member (if any). Records are
+// counted in count and pending, if not nil.
+func NewWARCTraversalFunc(done <-chan struct{}, filter detect.AbstractRegexp, source string, member string, out chan<- *buffer, count *atomic.Uint64, pending *sync.WaitGroup) func(*warc.Record) error {
 	return func(r *warc.Record) error {
 		select {
 		case <-done:
@@ -259,7 +847,11 @@ func NewWARCTraversalFunc(done <-chan struct{}, filter detect.AbstractRegexp, ou
 
 		default:
 			// Bail if wrong type or payload
-			if (r.Type != warc.RecordTypeResponse) || (!mime.IsText(r.IdentifiedPayloadType) && !mime.IsText(r.HTTPContentType)) {
+			isJSONMetadata := (r.Type == warc.RecordTypeMetadata) && mime.IsJSON(r.ContentType)
+			isTextResponse := (r.Type == warc.RecordTypeResponse) && (mime.IsText(r.IdentifiedPayloadType) || mime.IsText(r.HTTPContentType))
+			isMultipartResponse := (r.Type == warc.RecordTypeResponse) && warc.IsMultipart(r.HTTPContentType)
+
+			if !isJSONMetadata && !isTextResponse && !isMultipartResponse {
 				return nil
 			}
 
@@ -268,16 +860,49 @@ func NewWARCTraversalFunc(done <-chan struct{}, filter detect.AbstractRegexp, ou
 				return nil
 			}
 
-			// Read full record content
-			content, err := io.ReadAll(r.Content)
-			if err != nil {
-				return fmt.Errorf("read record content: %w", err)
+			// Read record content
+			var buffers []*buffer
+
+			switch {
+			case isJSONMetadata:
+				// Extract string values from JSON metadata (e.g. WAT files)
+				buffers = []*buffer{readJSONMetadata(r)}
+
+			case isMultipartResponse:
+				// Split multipart body into parts
+				bs, err := readMultipart(r, isTextResponse)
+				if err != nil {
+					return err
+				}
+
+				buffers = bs
+
+			default:
+				// Read full record content
+				content, err := io.ReadAll(r.Content)
+				if err != nil {
+					return fmt.Errorf("read record content: %w", err)
+				}
+
+				buffers = []*buffer{{TargetURI: r.TargetURI, Content: content}}
 			}
 
 			// Hand over to processing
-			out <- &buffer{
-				TargetURI: r.TargetURI,
-				Content:   content,
+			for _, b := range buffers {
+				b.Source = source
+				b.Member = member
+				b.Pending = pending
+
+				if pending != nil {
+					pending.Add(1)
+				}
+
+				select {
+				case out <- b:
+				case <-done:
+					b.done()
+					return warc.ErrBreakTraversal
+				}
 			}
 
 			// Increment record count, if given
@@ -289,3 +914,73 @@ func NewWARCTraversalFunc(done <-chan struct{}, filter detect.AbstractRegexp, ou
 		return nil
 	}
 }
+
+// readJSONMetadata extracts all string values of the JSON metadata record r into a buffer, one value per line,
+// so that each finding can be mapped back to the JSON path of its value.
+func readJSONMetadata(r *warc.Record) *buffer {
+	var content bytes.Buffer
+	var paths []string
+
+	// Keep values on a single line, to not break the mapping
+	nlr := strings.NewReplacer("\r", " ", "\n", " ")
+
+	// Malformed JSON is not fatal, values extracted up to the error are still checked
+	_ = warc.WalkJSON(r.Content, func(path string, value string) error {
+		content.WriteString(nlr.Replace(value))
+		content.WriteByte('\n')
+
+		paths = append(paths, path)
+		return nil
+	})
+
+	return &buffer{
+		TargetURI: r.TargetURI,
+		Content:   content.Bytes(),
+		Paths:     paths,
+	}
+}
+
+// readMultipart splits the multipart HTTP response r into a buffer for each textual part. If the body can't be
+// split, the full record content is returned instead if asText is set.
+func readMultipart(r *warc.Record, asText bool) ([]*buffer, error) {
+	// Read full record content
+	content, err := io.ReadAll(r.Content)
+	if err != nil {
+		return nil, fmt.Errorf("read record content: %w", err)
+	}
+
+	// Read textual parts
+	var buffers []*buffer
+
+	err = warc.TraverseMultipart(bytes.NewReader(content), r.HTTPContentType, func(p *warc.Part) error {
+		// Bail if wrong payload
+		if !mime.IsText(p.ContentType) {
+			return nil
+		}
+
+		// Read full part content
+		pc, err := io.ReadAll(p.Content)
+		if err != nil {
+			return fmt.Errorf("read part content: %w", err)
+		}
+
+		buffers = append(buffers, &buffer{
+			TargetURI: r.TargetURI,
+			Content:   pc,
+			Part:      &part{Index: p.Index, Name: p.Name},
+		})
+
+		return nil
+	})
+
+	// Fall back to full record content for malformed multipart bodies, if textual
+	if err != nil {
+		buffers = nil
+
+		if asText {
+			buffers = []*buffer{{TargetURI: r.TargetURI, Content: content}}
+		}
+	}
+
+	return buffers, nil
+}
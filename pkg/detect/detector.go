@@ -2,6 +2,7 @@ package detect
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"regexp"
@@ -61,8 +62,9 @@ type state struct {
 	locator *Locator // A locator to turn indexes into lines and columns.
 }
 
-// Detect will detect all secrets in the given reader stream.
-func (d *Detector) Detect(r io.Reader) ([]*Finding, error) {
+// Detect will detect all secrets in the given reader stream. Detection stops with an error once the context is
+// canceled.
+func (d *Detector) Detect(ctx context.Context, r io.Reader) ([]*Finding, error) {
 	// Turn the reader into a string
 	var s state
 
@@ -88,6 +90,10 @@ func (d *Detector) Detect(r io.Reader) ([]*Finding, error) {
 	var findings []*Finding
 
 	for _, r := range d.rules {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		findings = append(findings, d.detectRule(&s, r)...)
 	}
 
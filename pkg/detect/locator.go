@@ -29,7 +29,7 @@ func (l *Locator) Find(startIdx int, endIdx int) *Location {
 	startLine := 0
 
 	for ; startLine < len(l.newLineIndexes)-1; startLine++ {
-		if l.newLineIndexes[startLine+1] >= startIdx {
+		if l.newLineIndexes[startLine+1] > startIdx {
 			break
 		}
 	}
@@ -0,0 +1,58 @@
+package detect
+
+import (
+	"testing"
+)
+
+func TestLocatorFind(t *testing.T) {
+	s := "first\nsecret\n\nlast"
+
+	tests := []struct {
+		name     string
+		startIdx int
+		endIdx   int
+		want     Location
+	}{
+		{
+			name:     "start of first line",
+			startIdx: 0,
+			endIdx:   5,
+			want:     Location{StartIdx: 0, EndIdx: 5, StartLine: 0, EndLine: 0, StartColumn: 0, EndColumn: 5, StartLineIdx: 0, EndLineIdx: 5},
+		},
+		{
+			name:     "start of second line",
+			startIdx: 6,
+			endIdx:   12,
+			want:     Location{StartIdx: 6, EndIdx: 12, StartLine: 1, EndLine: 1, StartColumn: 0, EndColumn: 6, StartLineIdx: 6, EndLineIdx: 12},
+		},
+		{
+			name:     "within second line",
+			startIdx: 8,
+			endIdx:   10,
+			want:     Location{StartIdx: 8, EndIdx: 10, StartLine: 1, EndLine: 1, StartColumn: 2, EndColumn: 4, StartLineIdx: 6, EndLineIdx: 12},
+		},
+		{
+			name:     "spanning lines",
+			startIdx: 3,
+			endIdx:   8,
+			want:     Location{StartIdx: 3, EndIdx: 8, StartLine: 0, EndLine: 1, StartColumn: 3, EndColumn: 2, StartLineIdx: 0, EndLineIdx: 12},
+		},
+		{
+			name:     "start of last line",
+			startIdx: 14,
+			endIdx:   18,
+			want:     Location{StartIdx: 14, EndIdx: 18, StartLine: 3, EndLine: 3, StartColumn: 0, EndColumn: 4, StartLineIdx: 14, EndLineIdx: 18},
+		},
+	}
+
+	l := NewLocator(s)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := l.Find(tt.startIdx, tt.endIdx)
+			if *got != tt.want {
+				t.Errorf("Find(%d, %d) = %+v, want %+v", tt.startIdx, tt.endIdx, *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package fetch
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// azureConnectionStringEnv is the environment variable containing an Azure Storage connection string, as
+	// used by the Azure CLI and the official client libraries.
+	azureConnectionStringEnv = "AZURE_STORAGE_CONNECTION_STRING"
+
+	// azureAccountEnv is the environment variable containing the Azure Storage account name.
+	azureAccountEnv = "AZURE_STORAGE_ACCOUNT"
+
+	// azureKeyEnv is the environment variable containing the Azure Storage account key.
+	azureKeyEnv = "AZURE_STORAGE_KEY"
+
+	// azureSASTokenEnv is the environment variable containing an Azure Storage SAS token.
+	azureSASTokenEnv = "AZURE_STORAGE_SAS_TOKEN"
+
+	// azureAPIVersion is the version of the Azure Blob Storage REST API used for requests.
+	azureAPIVersion = "2021-12-02"
+
+	// azureEndpointSuffix is the default endpoint suffix of Azure Storage.
+	azureEndpointSuffix = "core.windows.net"
+
+	// azuriteAccount and azuriteKey are the well-known credentials of the Azurite storage emulator, used for
+	// "UseDevelopmentStorage=true".
+	azuriteAccount  = "devstoreaccount1"
+	azuriteKey      = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	azuriteEndpoint = "http://127.0.0.1:10000/" + azuriteAccount
+)
+
+// azureCredentials wraps the endpoint and credentials used to access Azure Blob Storage.
+type azureCredentials struct {
+	endpoint string // Blob service endpoint (including the account name for path-style endpoints like Azurite)
+	account  string // Account name
+	key      []byte // Account key for shared key authorization, if any
+	sas      string // SAS token, if any
+}
+
+// openAzureURL returns the given Azure Blob Storage URL ("az://container/blob" or
+// "abfs[s]://container@account.dfs.core.windows.net/blob"), starting at the given offset and limited to length
+// bytes (unless negative).
+func openAzureURL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	// Determine container, blob, and (for ABFS) account and endpoint suffix
+	container, blob, account, suffix := u.Host, strings.TrimPrefix(u.Path, "/"), "", ""
+
+	if (u.Scheme == "abfs") || (u.Scheme == "abfss") {
+		if u.User == nil {
+			return nil, backoff.Permanent(fmt.Errorf("Azure fetch [url=%s]: missing container", u.String()))
+		}
+
+		container = u.User.Username()
+		account, suffix, _ = strings.Cut(u.Hostname(), ".")
+		suffix = strings.TrimPrefix(suffix, "dfs.")
+	}
+
+	if (container == "") || (blob == "") {
+		return nil, backoff.Permanent(fmt.Errorf("Azure fetch [url=%s]: missing container or blob", u.String()))
+	}
+
+	// Resolve endpoint and credentials
+	creds, err := resolveAzureCredentials(params, account, suffix)
+	if err != nil {
+		return nil, backoff.Permanent(fmt.Errorf("Azure fetch [url=%s]: %w", u.String(), err))
+	}
+
+	// Create blob URL
+	segments := strings.Split(blob, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	target := fmt.Sprintf(
+		"%s/%s/%s",
+		strings.TrimSuffix(creds.endpoint, "/"),
+		url.PathEscape(container),
+		strings.Join(segments, "/"),
+	)
+
+	if creds.sas != "" {
+		target += "?" + creds.sas
+	}
+
+	// Fetch blob, only resuming with the same version of the blob
+	obj, _, err := openHTTP(ctx, target, params, offset, length, prev, func(req *http.Request) error {
+		req.Header.Set("x-ms-version", azureAPIVersion)
+
+		if (prev != nil) && (prev.etag != "") {
+			req.Header.Set("If-Match", prev.etag)
+		}
+
+		if (creds.sas == "") && (creds.key != nil) {
+			signAzureRequest(req, creds.account, creds.key)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Azure fetch [url=%s]: %w", u.String(), err)
+	}
+
+	return obj, nil
+}
+
+// resolveAzureCredentials determines the endpoint and credentials from the given parameters, falling back to
+// the standard environment variables. The account name and endpoint suffix taken from the URL (if not empty)
+// take precedence.
+func resolveAzureCredentials(params *params, account string, suffix string) (*azureCredentials, error) {
+	// Parse connection string
+	cs := params.azureConnectionString
+	if cs == "" {
+		cs = os.Getenv(azureConnectionStringEnv)
+	}
+
+	settings, err := parseAzureConnectionString(cs)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(settings["usedevelopmentstorage"], "true") {
+		settings["accountname"] = azuriteAccount
+		settings["accountkey"] = azuriteKey
+		settings["blobendpoint"] = azuriteEndpoint
+	}
+
+	// Account name
+	creds := &azureCredentials{
+		account: firstNonEmpty(account, params.azureAccount, settings["accountname"], os.Getenv(azureAccountEnv)),
+	}
+
+	// Endpoint
+	creds.endpoint = firstNonEmpty(params.azureEndpoint, settings["blobendpoint"])
+
+	if creds.endpoint == "" {
+		if creds.account == "" {
+			return nil, errors.New("missing Azure Storage account name")
+		}
+
+		creds.endpoint = fmt.Sprintf(
+			"%s://%s.blob.%s",
+			firstNonEmpty(settings["defaultendpointsprotocol"], "https"),
+			creds.account,
+			firstNonEmpty(suffix, settings["endpointsuffix"], azureEndpointSuffix),
+		)
+	}
+
+	if creds.account == "" {
+		// Path-style endpoints (like Azurite) contain the account name
+		eu, err := url.Parse(creds.endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parse Azure endpoint: %w", err)
+		}
+
+		creds.account, _, _ = strings.Cut(strings.TrimPrefix(eu.Path, "/"), "/")
+	}
+
+	// Credentials, either a SAS token or an account key. Without any of both, access is anonymous.
+	creds.sas = strings.TrimPrefix(firstNonEmpty(params.azureSASToken, settings["sharedaccesssignature"], os.Getenv(azureSASTokenEnv)), "?")
+
+	if key := firstNonEmpty(settings["accountkey"], os.Getenv(azureKeyEnv)); key != "" {
+		creds.key, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("decode Azure Storage account key: %w", err)
+		}
+	}
+
+	return creds, nil
+}
+
+// parseAzureConnectionString parses an Azure Storage connection string (e.g.
+// "AccountName=name;AccountKey=key;EndpointSuffix=core.windows.net") into a map with lowercase keys.
+func parseAzureConnectionString(cs string) (map[string]string, error) {
+	settings := make(map[string]string)
+
+	for _, kv := range strings.Split(cs, ";") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf(`connection string setting must be of the form "key=value" [setting=%s]`, kv)
+		}
+
+		settings[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+
+	return settings, nil
+}
+
+// signAzureRequest authorizes the request req with the given account name and key, using the shared key
+// scheme. All other headers must have been set before.
+//
+// See https://learn.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func signAzureRequest(req *http.Request, account string, key []byte) {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	// Canonicalized headers
+	var names []string
+
+	for name := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			names = append(names, name)
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) })
+
+	var headers strings.Builder
+
+	for _, name := range names {
+		fmt.Fprintf(&headers, "%s:%s\n", strings.ToLower(name), strings.TrimSpace(strings.Join(req.Header.Values(name), ",")))
+	}
+
+	// Canonicalized resource
+	var resource strings.Builder
+
+	fmt.Fprintf(&resource, "/%s%s", account, req.URL.EscapedPath())
+
+	query := req.URL.Query()
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		values := slices.Clone(query[k])
+		slices.Sort(values)
+
+		fmt.Fprintf(&resource, "\n%s:%s", strings.ToLower(k), strings.Join(values, ","))
+	}
+
+	// Sign
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		"", // Content-Length (none for GET)
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date (x-ms-date is used instead)
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		headers.String() + resource.String(),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+}
+
+// firstNonEmpty returns the first of the given values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,144 @@
+package fetch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSignAzureRequest tests authorizing requests using the shared key scheme, against the string-to-sign as
+// documented for the Azure Blob Storage REST API.
+func TestSignAzureRequest(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(azuriteKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		account string
+		headers map[string]string
+		want    string // String-to-sign, with "DATE" standing in for the x-ms-date header
+	}{
+		{
+			name:    "blob",
+			url:     "https://myaccount.blob.core.windows.net/container/dir/file.warc.gz",
+			account: "myaccount",
+			headers: map[string]string{"x-ms-version": azureAPIVersion},
+			want: "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:DATE\nx-ms-version:2021-12-02\n" +
+				"/myaccount/container/dir/file.warc.gz",
+		},
+		{
+			name:    "resumed blob",
+			url:     "https://myaccount.blob.core.windows.net/container/file.warc.gz",
+			account: "myaccount",
+			headers: map[string]string{
+				"x-ms-version":           azureAPIVersion,
+				"Range":                  "bytes=100-",
+				"If-Match":               `"0x8D9"`,
+				"X-Ms-Client-Request-Id": " id ",
+			},
+			want: "GET\n\n\n\n\n\n\n\n\"0x8D9\"\n\n\nbytes=100-\n" +
+				"x-ms-client-request-id:id\nx-ms-date:DATE\nx-ms-version:2021-12-02\n" +
+				"/myaccount/container/file.warc.gz",
+		},
+		{
+			name:    "path-style endpoint with escaped blob and query",
+			url:     "http://127.0.0.1:10000/devstoreaccount1/container/a%20b.warc?snapshot=2024-01-01&comp=tags&b=2&b=1",
+			account: azuriteAccount,
+			headers: map[string]string{"x-ms-version": azureAPIVersion},
+			want: "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:DATE\nx-ms-version:2021-12-02\n" +
+				"/devstoreaccount1/devstoreaccount1/container/a%20b.warc\nb:1,2\ncomp:tags\nsnapshot:2024-01-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			signAzureRequest(req, tt.account, key)
+
+			// Compute expected signature
+			date := req.Header.Get("x-ms-date")
+			if date == "" {
+				t.Fatalf("signAzureRequest() did not set x-ms-date")
+			}
+
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(strings.ReplaceAll(tt.want, "DATE", date)))
+
+			want := "SharedKey " + tt.account + ":" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("signAzureRequest() Authorization = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestParseAzureConnectionString tests parsing Azure Storage connection strings.
+func TestParseAzureConnectionString(t *testing.T) {
+	tests := []struct {
+		name    string
+		cs      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", cs: "", want: map[string]string{}},
+		{
+			name: "account",
+			cs:   "DefaultEndpointsProtocol=https;AccountName=name;AccountKey=a2V5;EndpointSuffix=core.windows.net;",
+			want: map[string]string{
+				"defaultendpointsprotocol": "https",
+				"accountname":              "name",
+				"accountkey":               "a2V5",
+				"endpointsuffix":           "core.windows.net",
+			},
+		},
+		{
+			name: "SAS token containing equal signs",
+			cs:   "BlobEndpoint=https://name.blob.core.windows.net/;SharedAccessSignature=sv=2021-12-02&sig=abc%3D",
+			want: map[string]string{
+				"blobendpoint":          "https://name.blob.core.windows.net/",
+				"sharedaccesssignature": "sv=2021-12-02&sig=abc%3D",
+			},
+		},
+		{name: "invalid setting", cs: "AccountName=name;garbage", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAzureConnectionString(tt.cs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAzureConnectionString() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("parseAzureConnectionString() = %v, want %v", got, tt.want)
+			}
+
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseAzureConnectionString()[%q] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
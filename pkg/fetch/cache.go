@@ -0,0 +1,242 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// cacheTempSuffix is the suffix of cache files that are still being written.
+	cacheTempSuffix = ".tmp"
+
+	// cacheTempMaxAge is the age after which cache files that are still being written are considered left over
+	// by a crashed run. Cache files are modified on every read of the content, so downloads in progress are
+	// never that old, unless stalled without idle timeout.
+	cacheTempMaxAge = 24 * time.Hour
+)
+
+// cacheKey returns the cache key of the object obj opened from URL u, or false if the object can't be cached
+// because it has no validator (like an ETag) that tells whether a cached copy is still up to date.
+func cacheKey(u *url.URL, obj *object) (string, bool) {
+	if (obj.etag == "") && (obj.lastModified == "") && (obj.version == "") {
+		return "", false
+	}
+
+	h := sha256.Sum256([]byte(strings.Join([]string{u.String(), obj.etag, obj.lastModified, obj.version}, "\n")))
+	return hex.EncodeToString(h[:]), true
+}
+
+// openCached opens the cached copy with the given key, or returns false if there is none. Opening marks the
+// copy as recently used.
+func openCached(dir string, key string) (*os.File, bool) {
+	path := filepath.Join(dir, key)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return f, true
+}
+
+// openValidatedCache opens the cached copy of the object at URL u, if there is one that is still up to date,
+// without requesting the content of the object. Only the first byte of the object is requested, which tells the
+// current validator (like the ETag). Nil is returned on a cache miss, or if the object can't be validated this
+// way (like if the server does not support ranges).
+func openValidatedCache(ctx context.Context, u *url.URL, params *params, open openFunc) io.ReadCloser {
+	// Request first byte
+	probe, err := open(ctx, u, params, 0, 1, nil)
+	if err != nil {
+		return nil
+	}
+
+	probe.body.Close()
+
+	// Look up cached copy
+	key, ok := cacheKey(u, probe)
+	if !ok {
+		return nil
+	}
+
+	f, ok := openCached(params.cacheDir, key)
+	if !ok {
+		return nil
+	}
+
+	// Verify against checksum, if requested. Checksums provided along with the full object may be missing for
+	// the first byte, so leave it to fetching the full object if none is found.
+	var sum *checksum
+
+	if params.checksum != "" {
+		sum, err = resolveChecksum(ctx, u, params, open, probe)
+		if err != nil {
+			f.Close()
+			return nil
+		}
+	}
+
+	return finishReader(f, probe.size, sum)
+}
+
+// cachingReader wraps a content reader, writing everything read into a new cache file. The cache file is only
+// added to the cache once the content was read completely.
+type cachingReader struct {
+	body    io.ReadCloser
+	dir     string
+	key     string
+	maxSize int64    // Maximum size of the cache, or zero if unbounded
+	size    int64    // Expected size of the content, or -1 if unknown
+	tmp     *os.File // Cache file being written, or nil if caching was given up
+	written int64
+}
+
+// newCachingReader wraps body, caching its content in directory dir under the given key. The cache is kept
+// below maxSize bytes (unless zero) by evicting the least recently used files. If the content can't be cached,
+// body is returned as is.
+func newCachingReader(body io.ReadCloser, dir string, key string, maxSize int64, size int64) io.ReadCloser {
+	// Bail if the content won't ever fit
+	if (maxSize > 0) && (size > maxSize) {
+		return body
+	}
+
+	tmp, err := os.CreateTemp(dir, key+"-*"+cacheTempSuffix)
+	if err != nil {
+		return body
+	}
+
+	return &cachingReader{body: body, dir: dir, key: key, maxSize: maxSize, size: size, tmp: tmp}
+}
+
+// Read reads up to len(p) bytes into p.
+func (cr *cachingReader) Read(p []byte) (int, error) {
+	n, err := cr.body.Read(p)
+
+	if (n > 0) && (cr.tmp != nil) {
+		// Give up caching on write errors (like a full disk), but keep on reading
+		_, werr := cr.tmp.Write(p[:n])
+		if werr != nil {
+			cr.abandon()
+		}
+
+		cr.written += int64(n)
+	}
+
+	if (err == io.EOF) && (cr.tmp != nil) {
+		cr.commit()
+	}
+
+	return n, err
+}
+
+// Close closes the content reader, dropping the cache file if the content was not read completely.
+func (cr *cachingReader) Close() error {
+	if cr.tmp != nil {
+		cr.abandon()
+	}
+
+	return cr.body.Close()
+}
+
+// commit adds the completely written cache file to the cache.
+func (cr *cachingReader) commit() {
+	tmp := cr.tmp
+	cr.tmp = nil
+
+	// Drop incomplete content
+	if (cr.size >= 0) && (cr.written != cr.size) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+
+	err := tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(cr.dir, cr.key))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	evictCache(cr.dir, cr.maxSize)
+}
+
+// abandon drops the cache file.
+func (cr *cachingReader) abandon() {
+	cr.tmp.Close()
+	os.Remove(cr.tmp.Name())
+
+	cr.tmp = nil
+}
+
+// evictCache removes the least recently used files from the cache in directory dir, until the cache is not
+// larger than maxSize bytes (unless zero). Files that are still being written are ignored, unless they were
+// left over by a crashed run.
+func evictCache(dir string, maxSize int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	// Collect cache files
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []cacheFile
+	var total int64
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		// Remove files left over by crashed runs
+		if strings.HasSuffix(e.Name(), cacheTempSuffix) {
+			if time.Since(fi.ModTime()) > cacheTempMaxAge {
+				os.Remove(filepath.Join(dir, e.Name()))
+			}
+
+			continue
+		}
+
+		if maxSize <= 0 {
+			continue
+		}
+
+		files = append(files, cacheFile{path: filepath.Join(dir, e.Name()), size: fi.Size(), modTime: fi.ModTime()})
+		total += fi.Size()
+	}
+
+	// Remove least recently used files first
+	slices.SortFunc(files, func(a, b cacheFile) int { return a.modTime.Compare(b.modTime) })
+
+	for _, f := range files {
+		if total <= maxSize {
+			break
+		}
+
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestOpenCached tests that cached copies are validated, and used without requesting the content.
+func TestOpenCached(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+
+	content := "WARC/1.0\r\n" + strings.Repeat("cached content\n", 100)
+	etag := `"v1"`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		mu.Unlock()
+
+		http.ServeContent(w, r, "file.warc", time.Time{}, strings.NewReader(content))
+	}))
+
+	defer srv.Close()
+
+	opts := []Option{WithCache(t.TempDir(), 0)}
+
+	// fetch opens the object, returning the content and the Range headers of all requests
+	fetch := func() (string, []string) {
+		mu.Lock()
+		requests = nil
+		mu.Unlock()
+
+		r, err := Open(context.Background(), srv.URL+"/file.warc", opts...)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		defer r.Close()
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		return string(got), requests
+	}
+
+	tests := []struct {
+		name         string
+		etag         string
+		wantRequests []string
+	}{
+		{name: "miss", etag: `"v1"`, wantRequests: []string{"bytes=0-0", ""}},
+		{name: "hit", etag: `"v1"`, wantRequests: []string{"bytes=0-0"}},
+		{name: "changed", etag: `"v2"`, wantRequests: []string{"bytes=0-0", ""}},
+		{name: "hit after change", etag: `"v2"`, wantRequests: []string{"bytes=0-0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			etag = tt.etag
+			mu.Unlock()
+
+			got, requests := fetch()
+
+			if got != content {
+				t.Errorf("ReadAll() = %q, want %q", got, content)
+			}
+
+			if strings.Join(requests, ",") != strings.Join(tt.wantRequests, ",") {
+				t.Errorf("Open() requested ranges %q, want %q", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// TestEvictCache tests that the least recently used files are evicted, and files left over by crashed runs are
+// removed.
+func TestEvictCache(t *testing.T) {
+	type cacheFile struct {
+		name string
+		size int
+		age  time.Duration
+	}
+
+	files := []cacheFile{
+		{name: "old", size: 100, age: 3 * time.Hour},
+		{name: "recent", size: 100, age: time.Hour},
+		{name: "new", size: 100, age: time.Minute},
+		{name: "new-123" + cacheTempSuffix, size: 1000, age: time.Minute},
+		{name: "stale-456" + cacheTempSuffix, size: 10, age: 2 * cacheTempMaxAge},
+	}
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		want    []string
+	}{
+		{name: "unbounded", maxSize: 0, want: []string{"new", "new-123.tmp", "old", "recent"}},
+		{name: "within size", maxSize: 300, want: []string{"new", "new-123.tmp", "old", "recent"}},
+		{name: "evict one", maxSize: 250, want: []string{"new", "new-123.tmp", "recent"}},
+		{name: "evict all but one", maxSize: 100, want: []string{"new", "new-123.tmp"}},
+		{name: "evict all", maxSize: 1, want: []string{"new-123.tmp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, f := range files {
+				path := filepath.Join(dir, f.name)
+
+				err := os.WriteFile(path, make([]byte, f.size), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mtime := time.Now().Add(-f.age)
+
+				err = os.Chtimes(path, mtime, mtime)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			evictCache(dir, tt.maxSize)
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evictCache() left %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCCEndpoint is the default endpoint of Common Crawl.
+	DefaultCCEndpoint = "https://data.commoncrawl.org"
+)
+
+var (
+	// ccCrawlRegexp matches the identifiers of Common Crawl crawls (like "CC-MAIN-2023-50").
+	ccCrawlRegexp = regexp.MustCompile(`^CC-MAIN-\d{4}-\d{2}$`)
+
+	// ccTypes are the types of archives of Common Crawl crawls.
+	ccTypes = []string{"warc", "wet", "wat"}
+)
+
+// expandCCURL expands URL u ("cc://CC-MAIN-2023-50", optionally followed by "/warc", "/wet", or "/wat") into
+// the addresses of all archives of that type of the Common Crawl crawl, as listed by its paths manifest (like
+// "warc.paths.gz"). The manifest is read from the configured endpoint, which is also prepended to all archive
+// paths. The "segments" query parameter limits the archives to that many segments chosen at random, using the
+// "seed" query parameter (zero by default), so all shards of a scan choose the same segments.
+func expandCCURL(ctx context.Context, u *url.URL, params *params, opts []Option) ([]string, error) {
+	// Parse URL
+	crawl := strings.ToUpper(u.Host)
+	if !ccCrawlRegexp.MatchString(crawl) {
+		return nil, fmt.Errorf(`Common Crawl URL must be of the form "cc://CC-MAIN-YYYY-WW" [url=%s]`, u)
+	}
+
+	typ := strings.ToLower(strings.Trim(u.Path, "/"))
+	if typ == "" {
+		typ = "warc"
+	}
+
+	if !slices.Contains(ccTypes, typ) {
+		return nil, fmt.Errorf("unknown Common Crawl archive type, must be one of warc, wet, wat [type=%s]", typ)
+	}
+
+	segments, seed, err := parseCCSampling(u.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	// Read manifest
+	endpoint := strings.TrimSuffix(params.ccEndpoint, "/")
+	if endpoint == "" {
+		endpoint = DefaultCCEndpoint
+	}
+
+	manifest := endpoint + "/crawl-data/" + crawl + "/" + typ + ".paths.gz"
+
+	paths, err := readCCManifest(ctx, manifest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("read Common Crawl manifest [url=%s]: %w", redactURL(manifest), err)
+	}
+
+	// Sample segments, if requested
+	if segments > 0 {
+		paths = sampleCCSegments(paths, segments, seed)
+	}
+
+	addrs := make([]string, len(paths))
+	for i, p := range paths {
+		addrs[i] = endpoint + "/" + p
+	}
+
+	return addrs, nil
+}
+
+// parseCCSampling parses the "segments" and "seed" query parameters of Common Crawl URLs.
+func parseCCSampling(q url.Values) (int, uint64, error) {
+	var segments int
+	var seed uint64
+
+	if v := q.Get("segments"); v != "" {
+		n, err := strconv.Atoi(v)
+		if (err != nil) || (n <= 0) {
+			return 0, 0, fmt.Errorf("segments must be a positive number [segments=%s]", v)
+		}
+
+		segments = n
+	}
+
+	if v := q.Get("seed"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("seed must be a non-negative number [seed=%s]", v)
+		}
+
+		seed = n
+	}
+
+	return segments, seed, nil
+}
+
+// readCCManifest reads the archive paths listed in the (compressed) Common Crawl manifest at addr.
+func readCCManifest(ctx context.Context, addr string, opts []Option) ([]string, error) {
+	fr, err := Open(ctx, addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fr.Close()
+
+	dr, err := NewDecompressionReader(fr, WithFileName(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	defer dr.Close()
+
+	// Read paths line by line
+	var paths []string
+
+	scanner := bufio.NewScanner(dr)
+
+	for scanner.Scan() {
+		p := strings.TrimSpace(scanner.Text())
+		if p != "" {
+			paths = append(paths, strings.TrimPrefix(p, "/"))
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("empty manifest")
+	}
+
+	return paths, nil
+}
+
+// sampleCCSegments returns the paths of n segments chosen at random (reproducibly, using the given seed),
+// keeping their order. Segments are identified by the path component following "segments/".
+func sampleCCSegments(paths []string, n int, seed uint64) []string {
+	// Collect segments, in order of appearance
+	var segments []string
+	seen := map[string]bool{}
+
+	for _, p := range paths {
+		s := ccSegment(p)
+		if !seen[s] {
+			seen[s] = true
+			segments = append(segments, s)
+		}
+	}
+
+	// Choose segments
+	chosen := map[string]bool{}
+	rng := rand.New(rand.NewPCG(seed, 0))
+
+	for _, i := range rng.Perm(len(segments))[:min(n, len(segments))] {
+		chosen[segments[i]] = true
+	}
+
+	var sampled []string
+
+	for _, p := range paths {
+		if chosen[ccSegment(p)] {
+			sampled = append(sampled, p)
+		}
+	}
+
+	return sampled
+}
+
+// ccSegment returns the segment of a Common Crawl archive path (like
+// "crawl-data/CC-MAIN-2023-50/segments/1700679099281.67/warc/example.warc.gz"), or the path itself if it has none.
+func ccSegment(p string) string {
+	_, rest, ok := strings.Cut(p, "/segments/")
+	if !ok {
+		return p
+	}
+
+	segment, _, _ := strings.Cut(rest, "/")
+	return segment
+}
@@ -0,0 +1,193 @@
+package fetch
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ccPaths are the archive paths of the Common Crawl mirror created by newCCMirror.
+var ccPaths = map[string][]string{
+	"warc": {
+		"crawl-data/CC-MAIN-2023-50/segments/1700679099281.67/warc/a.warc.gz",
+		"crawl-data/CC-MAIN-2023-50/segments/1700679099281.67/warc/b.warc.gz",
+		"crawl-data/CC-MAIN-2023-50/segments/1700679099892.46/warc/c.warc.gz",
+		"crawl-data/CC-MAIN-2023-50/segments/1700679100018.19/warc/d.warc.gz",
+	},
+	"wet": {
+		"crawl-data/CC-MAIN-2023-50/segments/1700679099281.67/wet/a.warc.wet.gz",
+	},
+	"wat": {},
+}
+
+// newCCMirror creates a local directory mirroring the crawl data of Common Crawl crawl "CC-MAIN-2023-50", and
+// returns its path.
+func newCCMirror(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for typ, paths := range ccPaths {
+		// Archives
+		for _, p := range paths {
+			writeGzipFile(t, filepath.Join(dir, filepath.FromSlash(p)), "WARC/1.0\r\n"+p+"\r\n")
+		}
+
+		// Manifest, with leading slashes and blank lines as seen in the wild
+		var manifest string
+		for _, p := range paths {
+			manifest += "/" + p + "\n\n"
+		}
+
+		writeGzipFile(t, filepath.Join(dir, "crawl-data", "CC-MAIN-2023-50", typ+".paths.gz"), manifest)
+	}
+
+	return dir
+}
+
+// writeGzipFile writes the gzip compressed content to the file at path, creating parent directories.
+func writeGzipFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+
+	_, err = zw.Write([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExpandCC tests expanding Common Crawl crawls, using a local directory mirroring the crawl data.
+func TestExpandCC(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		want    []string // Archive paths, relative to the endpoint
+		wantErr bool
+	}{
+		{name: "default type", addr: "cc://CC-MAIN-2023-50", want: ccPaths["warc"]},
+		{name: "WARC", addr: "cc://CC-MAIN-2023-50/warc", want: ccPaths["warc"]},
+		{name: "WET", addr: "cc://cc-main-2023-50/WET/", want: ccPaths["wet"]},
+		{name: "too many segments", addr: "cc://CC-MAIN-2023-50/warc?segments=10", want: ccPaths["warc"]},
+		{name: "empty manifest", addr: "cc://CC-MAIN-2023-50/wat", wantErr: true},
+		{name: "missing crawl", addr: "cc://CC-MAIN-2000-01", wantErr: true},
+		{name: "invalid crawl", addr: "cc://CC-NEWS-2023-50", wantErr: true},
+		{name: "invalid type", addr: "cc://CC-MAIN-2023-50/cdx", wantErr: true},
+		{name: "invalid segments", addr: "cc://CC-MAIN-2023-50?segments=0", wantErr: true},
+		{name: "invalid seed", addr: "cc://CC-MAIN-2023-50?segments=1&seed=-1", wantErr: true},
+	}
+
+	dir := newCCMirror(t)
+
+	endpoints := map[string]string{
+		"directory": dir,
+		"file URL":  "file://" + filepath.ToSlash(dir) + "/",
+	}
+
+	for kind, endpoint := range endpoints {
+		for _, tt := range tests {
+			t.Run(kind+"/"+tt.name, func(t *testing.T) {
+				got, err := Expand(context.Background(), tt.addr, WithCCEndpoint(endpoint))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Expand() error = %v, want error %t", err, tt.wantErr)
+				}
+
+				if tt.wantErr {
+					return
+				}
+
+				want := make([]string, len(tt.want))
+				for i, p := range tt.want {
+					want[i] = strings.TrimSuffix(endpoint, "/") + "/" + p
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Expand() = %q, want %q", got, want)
+				}
+
+				// Archives are readable from the mirror
+				for i, addr := range got {
+					content, err := readAll(context.Background(), addr)
+					if err != nil {
+						t.Fatalf("Open() error = %v", err)
+					}
+
+					if !strings.HasPrefix(content, "\x1f\x8b") {
+						t.Errorf("Open() content of %s is not gzip compressed", tt.want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestSampleCCSegments tests sampling segments of Common Crawl crawls.
+func TestSampleCCSegments(t *testing.T) {
+	paths := ccPaths["warc"]
+
+	tests := []struct {
+		name     string
+		segments int
+		seed     uint64
+		want     int // Number of segments
+	}{
+		{name: "one segment", segments: 1, want: 1},
+		{name: "two segments", segments: 2, seed: 42, want: 2},
+		{name: "all segments", segments: 3, want: 3},
+		{name: "more than all segments", segments: 5, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sampleCCSegments(paths, tt.segments, tt.seed)
+
+			// Chosen segments are complete, and keep their order
+			segments := map[string]bool{}
+			for _, p := range got {
+				segments[ccSegment(p)] = true
+			}
+
+			if len(segments) != tt.want {
+				t.Errorf("sampleCCSegments() chose %d segments, want %d", len(segments), tt.want)
+			}
+
+			var want []string
+
+			for _, p := range paths {
+				if segments[ccSegment(p)] {
+					want = append(want, p)
+				}
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("sampleCCSegments() = %q, want %q", got, want)
+			}
+
+			// Same seed, same sample
+			if again := sampleCCSegments(paths, tt.segments, tt.seed); !reflect.DeepEqual(again, got) {
+				t.Errorf("sampleCCSegments() = %q, then %q", got, again)
+			}
+		})
+	}
+}
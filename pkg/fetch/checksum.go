@@ -0,0 +1,255 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"  //nolint:gosec // Only used to verify checksums provided by others
+	"crypto/sha1" //nolint:gosec // Only used to verify checksums provided by others
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	// ChecksumAuto is the checksum specification to take the checksum of each object from wherever it is available.
+	ChecksumAuto = "auto"
+
+	// maxSidecarSize is the maximum size of a sidecar checksum file that is read.
+	maxSidecarSize = 64 * 1024
+)
+
+var (
+	// ErrChecksumMismatch is returned when reading an object whose content does not match its checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// checksumAlgorithms maps the names of the supported checksum algorithms to their hash functions.
+	checksumAlgorithms = map[string]func() hash.Hash{
+		"sha512": sha512.New,
+		"sha256": sha256.New,
+		"sha1":   sha1.New,
+		"md5":    md5.New,
+	}
+
+	// sidecarAlgorithms are the checksum algorithms looked for in sidecar files (like "example.warc.gz.sha256"),
+	// strongest first.
+	sidecarAlgorithms = []string{"sha256", "sha1", "md5"}
+)
+
+// checksum wraps the expected checksum of an object.
+type checksum struct {
+	algorithm string // Name of the algorithm (like "sha256")
+	digest    []byte // Expected digest
+	source    string // Where the checksum was taken from
+}
+
+// parseChecksum parses a checksum specification of the form "algorithm:hex digest" (like "sha256:e3b0c442...").
+func parseChecksum(spec string, source string) (*checksum, error) {
+	algorithm, rawDigest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf(`checksum must be of the form "algorithm:digest" [checksum=%s]`, spec)
+	}
+
+	return newChecksum(strings.ToLower(strings.TrimSpace(algorithm)), strings.TrimSpace(rawDigest), source)
+}
+
+// newChecksum returns the checksum using the given algorithm and hex encoded digest.
+func newChecksum(algorithm string, rawDigest string, source string) (*checksum, error) {
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown checksum algorithm, must be one of sha512, sha256, sha1, md5 [algorithm=%s]", algorithm)
+	}
+
+	digest, err := hex.DecodeString(rawDigest)
+	if (err != nil) || (len(digest) != newHash().Size()) {
+		return nil, fmt.Errorf("invalid %s digest [digest=%s]", algorithm, rawDigest)
+	}
+
+	return &checksum{algorithm: algorithm, digest: digest, source: source}, nil
+}
+
+// newBase64Checksum returns the checksum using the given algorithm and base64 encoded digest (as used by HTTP
+// headers), or nil if the digest is invalid.
+func newBase64Checksum(algorithm string, rawDigest string, source string) *checksum {
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rawDigest))
+	if err != nil {
+		return nil
+	}
+
+	sum, err := newChecksum(algorithm, hex.EncodeToString(digest), source)
+	if err != nil {
+		return nil
+	}
+
+	return sum
+}
+
+// resolveChecksum returns the checksum to verify object obj at URL u against, according to the checksum
+// specification of the parameters. With ChecksumAuto, the strongest checksum provided along with the object
+// (like an Amazon S3 SHA-256 checksum) is used, falling back to sidecar files (like "example.warc.gz.sha256"),
+// the "_files.xml" metadata of Internet Archive items, and finally to MD5 digests provided along with the object
+// (like Content-MD5 headers).
+func resolveChecksum(ctx context.Context, u *url.URL, params *params, open openFunc, obj *object) (*checksum, error) {
+	// Explicit checksum
+	if params.checksum != ChecksumAuto {
+		return parseChecksum(params.checksum, "explicit")
+	}
+
+	// Checksums provided along with the object, but MD5 only as a last resort
+	var weak *checksum
+
+	for _, c := range obj.checksums {
+		if c.algorithm == "md5" {
+			weak = c
+			continue
+		}
+
+		return c, nil
+	}
+
+	// Sidecar files
+	if sum, err := readSidecarChecksum(ctx, u, params, open); (sum != nil) || (err != nil) {
+		return sum, err
+	}
+
+	// Internet Archive item metadata
+	if sum, err := readIAChecksum(ctx, u, params); (sum != nil) || (err != nil) {
+		return sum, err
+	}
+
+	if weak != nil {
+		return weak, nil
+	}
+
+	return nil, errors.New("no checksum found")
+}
+
+// readSidecarChecksum reads the checksum of the object at URL u from a sidecar file next to it (like
+// "example.warc.gz.sha256", containing the hex digest as written by sha256sum). Nil is returned if there is no
+// sidecar file.
+func readSidecarChecksum(ctx context.Context, u *url.URL, params *params, open openFunc) (*checksum, error) {
+	for _, algorithm := range sidecarAlgorithms {
+		// Read sidecar file, if it exists
+		su := *u
+		su.Path += "." + algorithm
+		su.RawPath = ""
+
+		content, err := readSmallObject(ctx, &su, params, open)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("read checksum file [url=%s]: %w", redactURL(su.String()), err)
+		}
+
+		// Take first field, which is the hex digest
+		fields := strings.Fields(string(content))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty checksum file [url=%s]", redactURL(su.String()))
+		}
+
+		sum, err := newChecksum(algorithm, strings.TrimPrefix(fields[0], `\`), redactURL(su.String()))
+		if err != nil {
+			return nil, fmt.Errorf("parse checksum file [url=%s]: %w", redactURL(su.String()), err)
+		}
+
+		return sum, nil
+	}
+
+	return nil, nil
+}
+
+// isNotFound returns true if err was caused by a missing object. Denied access counts as missing, as some
+// services (like Amazon S3 without permission to list the bucket) report missing objects that way.
+func isNotFound(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return (se.StatusCode == http.StatusNotFound) || (se.StatusCode == http.StatusForbidden)
+	}
+
+	var re *smithyhttp.ResponseError
+	if errors.As(err, &re) {
+		return (re.HTTPStatusCode() == http.StatusNotFound) || (re.HTTPStatusCode() == http.StatusForbidden)
+	}
+
+	return false
+}
+
+// readSmallObject reads the full content of the (small) object at URL u, using the given open function.
+func readSmallObject(ctx context.Context, u *url.URL, params *params, open openFunc) ([]byte, error) {
+	return readSmallObjectLimit(ctx, u, params, open, maxSidecarSize)
+}
+
+// readSmallObjectLimit reads the content of the object at URL u up to maxSize bytes, using the given open
+// function.
+func readSmallObjectLimit(ctx context.Context, u *url.URL, params *params, open openFunc, maxSize int64) ([]byte, error) {
+	var content []byte
+
+	err := retry(ctx, params.newBackOff(), func() error {
+		obj, err := open(ctx, u, params, 0, -1, nil)
+		if err != nil {
+			return err
+		}
+
+		defer obj.body.Close()
+
+		content, err = io.ReadAll(io.LimitReader(obj.body, maxSize))
+		return err
+	})
+
+	return content, err
+}
+
+// verifyingReader wraps a content reader, verifying the content against a checksum once it was read completely.
+type verifyingReader struct {
+	body io.ReadCloser
+	sum  *checksum
+	hash hash.Hash
+}
+
+// newVerifyingReader wraps body, verifying its content against the given checksum.
+func newVerifyingReader(body io.ReadCloser, sum *checksum) *verifyingReader {
+	return &verifyingReader{body: body, sum: sum, hash: checksumAlgorithms[sum.algorithm]()}
+}
+
+// Read reads up to len(p) bytes into p. At the end of the content, ErrChecksumMismatch is returned instead of
+// io.EOF if the content does not match the checksum.
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.body.Read(p)
+	vr.hash.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := vr.hash.Sum(nil); !bytes.Equal(actual, vr.sum.digest) {
+			return n, fmt.Errorf(
+				"%w [algorithm=%s, expected=%x, actual=%x, source=%s]",
+				ErrChecksumMismatch,
+				vr.sum.algorithm,
+				vr.sum.digest,
+				actual,
+				vr.sum.source,
+			)
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the content reader.
+func (vr *verifyingReader) Close() error {
+	return vr.body.Close()
+}
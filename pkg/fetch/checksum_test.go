@@ -0,0 +1,258 @@
+package fetch
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// emptySHA256 is the hex encoded SHA-256 digest of empty content.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// emptySHA1 is the hex encoded SHA-1 digest of empty content.
+	emptySHA1 = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+
+	// emptyMD5 is the hex encoded MD5 digest of empty content.
+	emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+// TestParseChecksum tests parsing checksum specifications.
+func TestParseChecksum(t *testing.T) {
+	tests := []struct {
+		spec          string
+		wantAlgorithm string
+		wantErr       bool
+	}{
+		{spec: "sha256:" + emptySHA256, wantAlgorithm: "sha256"},
+		{spec: "SHA256:" + strings.ToUpper(emptySHA256), wantAlgorithm: "sha256"},
+		{spec: " sha1 : " + emptySHA1 + " ", wantAlgorithm: "sha1"},
+		{spec: "md5:" + emptyMD5, wantAlgorithm: "md5"},
+		{spec: "sha512:" + strings.Repeat("00", 64), wantAlgorithm: "sha512"},
+		{spec: emptySHA256, wantErr: true},
+		{spec: "crc32:00000000", wantErr: true},
+		{spec: "sha256:" + emptySHA1, wantErr: true},
+		{spec: "sha256:" + emptySHA256[:63] + "x", wantErr: true},
+		{spec: "sha256:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseChecksum(tt.spec, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChecksum() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got.algorithm != tt.wantAlgorithm) {
+				t.Errorf("parseChecksum() algorithm = %q, want %q", got.algorithm, tt.wantAlgorithm)
+			}
+		})
+	}
+}
+
+// TestNewBase64Checksum tests parsing base64 encoded digests, as provided by HTTP headers.
+func TestNewBase64Checksum(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		digest    string
+		want      string // Hex encoded digest, or empty if invalid
+	}{
+		{name: "md5", algorithm: "md5", digest: "1B2M2Y8AsgTpgAmY7PhCfg==", want: emptyMD5},
+		{name: "sha256", algorithm: "sha256", digest: "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", want: emptySHA256},
+		{name: "whitespace", algorithm: "md5", digest: " 1B2M2Y8AsgTpgAmY7PhCfg==\n", want: emptyMD5},
+		{name: "wrong length", algorithm: "sha256", digest: "1B2M2Y8AsgTpgAmY7PhCfg=="},
+		{name: "invalid base64", algorithm: "md5", digest: "not base64!"},
+		{name: "unknown algorithm", algorithm: "crc32c", digest: "AAAAAA=="},
+		{name: "empty", algorithm: "md5", digest: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newBase64Checksum(tt.algorithm, tt.digest, "test")
+
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("newBase64Checksum() = %x, want nil", got.digest)
+				}
+
+				return
+			}
+
+			if (got == nil) || (got.algorithm != tt.algorithm) {
+				t.Fatalf("newBase64Checksum() = %+v, want %s checksum", got, tt.algorithm)
+			}
+
+			if (hex.EncodeToString(got.digest) != tt.want) || (got.source != "test") {
+				t.Errorf("newBase64Checksum() digest = %x, want %s", got.digest, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadSidecarChecksum tests reading checksums from sidecar files next to an object.
+func TestReadSidecarChecksum(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string // Sidecar files by path
+		err           error             // Error returned for paths that are not in files
+		wantAlgorithm string
+		wantErr       bool
+	}{
+		{name: "no sidecar", err: fs.ErrNotExist},
+		{name: "not found", err: backoff.Permanent(&StatusError{StatusCode: http.StatusNotFound})},
+		{name: "forbidden", err: backoff.Permanent(&StatusError{StatusCode: http.StatusForbidden})},
+		{
+			name:          "sha256sum format",
+			files:         map[string]string{"/file.warc.gz.sha256": emptySHA256 + "  file.warc.gz\n"},
+			err:           fs.ErrNotExist,
+			wantAlgorithm: "sha256",
+		},
+		{
+			name:          "escaped file name",
+			files:         map[string]string{"/file.warc.gz.sha256": `\` + emptySHA256 + `  file\\.warc.gz` + "\n"},
+			err:           fs.ErrNotExist,
+			wantAlgorithm: "sha256",
+		},
+		{
+			name:          "digest only",
+			files:         map[string]string{"/file.warc.gz.md5": emptyMD5},
+			err:           fs.ErrNotExist,
+			wantAlgorithm: "md5",
+		},
+		{
+			name: "strongest first",
+			files: map[string]string{
+				"/file.warc.gz.md5":  emptyMD5,
+				"/file.warc.gz.sha1": emptySHA1,
+			},
+			err:           fs.ErrNotExist,
+			wantAlgorithm: "sha1",
+		},
+		{
+			name:    "empty sidecar",
+			files:   map[string]string{"/file.warc.gz.sha256": "\n"},
+			err:     fs.ErrNotExist,
+			wantErr: true,
+		},
+		{
+			name:    "invalid digest",
+			files:   map[string]string{"/file.warc.gz.sha256": emptyMD5 + "  file.warc.gz\n"},
+			err:     fs.ErrNotExist,
+			wantErr: true,
+		},
+		{
+			name:    "failed request",
+			err:     backoff.Permanent(&StatusError{StatusCode: http.StatusInternalServerError}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := newParams(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			u, _ := url.Parse("https://example.com/file.warc.gz")
+
+			got, err := readSidecarChecksum(context.Background(), u, params, stubOpenFunc(tt.files, tt.err))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readSidecarChecksum() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			switch {
+			case tt.wantErr:
+				return
+
+			case tt.wantAlgorithm == "":
+				if got != nil {
+					t.Errorf("readSidecarChecksum() = %+v, want nil", got)
+				}
+
+			case (got == nil) || (got.algorithm != tt.wantAlgorithm):
+				t.Errorf("readSidecarChecksum() = %+v, want %s checksum", got, tt.wantAlgorithm)
+
+			case got.source != "https://example.com/file.warc.gz."+tt.wantAlgorithm:
+				t.Errorf("readSidecarChecksum() source = %q", got.source)
+			}
+		})
+	}
+}
+
+// TestResolveChecksum tests choosing the checksum to verify an object against.
+func TestResolveChecksum(t *testing.T) {
+	sha256Sum := &checksum{algorithm: "sha256", source: "x-amz-checksum-sha256"}
+	md5Sum := &checksum{algorithm: "md5", source: "content-md5"}
+
+	tests := []struct {
+		name       string
+		spec       string
+		checksums  []*checksum       // Checksums provided along with the object
+		files      map[string]string // Sidecar files by path
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "explicit", spec: "sha256:" + emptySHA256, checksums: []*checksum{sha256Sum}, wantSource: "explicit"},
+		{name: "invalid explicit", spec: "sha256:", wantErr: true},
+		{name: "provided", checksums: []*checksum{md5Sum, sha256Sum}, wantSource: "x-amz-checksum-sha256"},
+		{
+			name:       "sidecar before MD5",
+			checksums:  []*checksum{md5Sum},
+			files:      map[string]string{"/file.warc.gz.sha1": emptySHA1},
+			wantSource: "https://example.com/file.warc.gz.sha1",
+		},
+		{name: "MD5 as last resort", checksums: []*checksum{md5Sum}, wantSource: "content-md5"},
+		{name: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			if spec == "" {
+				spec = ChecksumAuto
+			}
+
+			params, err := newParams([]Option{WithChecksum(spec)})
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+
+				t.Fatal(err)
+			}
+
+			u, _ := url.Parse("https://example.com/file.warc.gz")
+			obj := &object{checksums: tt.checksums}
+
+			got, err := resolveChecksum(context.Background(), u, params, stubOpenFunc(tt.files, fs.ErrNotExist), obj)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveChecksum() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got.source != tt.wantSource) {
+				t.Errorf("resolveChecksum() source = %q, want %q", got.source, tt.wantSource)
+			}
+		})
+	}
+}
+
+// stubOpenFunc returns an open function serving the given files (by path), and failing with err otherwise.
+func stubOpenFunc(files map[string]string, err error) openFunc {
+	return func(_ context.Context, u *url.URL, _ *params, _ int64, _ int64, _ *object) (*object, error) {
+		content, ok := files[u.Path]
+		if !ok {
+			return nil, err
+		}
+
+		return &object{body: io.NopCloser(strings.NewReader(content)), size: int64(len(content))}, nil
+	}
+}
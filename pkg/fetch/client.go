@@ -0,0 +1,128 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newHTTPClient returns a new HTTP client honoring the connect, response header, and overall timeouts, as well
+// as the proxy and TLS settings. The client is meant to be shared (see session), so connections are reused.
+func newHTTPClient(params *params) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	configureTransport(tr, params)
+
+	// Keep the connections of parallel downloads alive
+	tr.MaxIdleConnsPerHost = tr.MaxIdleConns
+
+	return &http.Client{Transport: tr, Timeout: params.timeout}
+}
+
+// configureTransport configures the HTTP transport tr to honor the connect and response header timeouts, as
+// well as the proxy and TLS settings.
+func configureTransport(tr *http.Transport, params *params) {
+	tr.DialContext = (&net.Dialer{Timeout: params.connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	tr.TLSHandshakeTimeout = params.connectTimeout
+	tr.ResponseHeaderTimeout = params.headerTimeout
+
+	if params.proxyURL != nil {
+		tr.Proxy = http.ProxyURL(params.proxyURL)
+	}
+
+	if params.tlsConfig != nil {
+		tr.TLSClientConfig = params.tlsConfig.Clone()
+	}
+}
+
+// load loads everything the parameters refer to (like the proxy URL, CA bundle, client certificate, netrc file,
+// SSH key, or cache directory), so that errors are reported before anything is fetched. It is called once per
+// session (see getSession).
+func (p *params) load() error {
+	// Proxy
+	if p.proxy != "" {
+		u, err := url.Parse(p.proxy)
+		if err != nil {
+			return fmt.Errorf("parse proxy URL: %w", err)
+		}
+
+		p.proxyURL = u
+	}
+
+	// TLS
+	if (p.caBundle != "") || (p.clientCert != "") {
+		tc := &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if p.caBundle != "" {
+			certs, err := os.ReadFile(p.caBundle)
+			if err != nil {
+				return fmt.Errorf("read CA bundle: %w", err)
+			}
+
+			// Add to system certificates
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+
+			if !pool.AppendCertsFromPEM(certs) {
+				return fmt.Errorf("no certificates found in CA bundle [file=%s]", p.caBundle)
+			}
+
+			tc.RootCAs = pool
+		}
+
+		if p.clientCert != "" {
+			// Key may be part of the certificate file
+			keyFile := p.clientKey
+			if keyFile == "" {
+				keyFile = p.clientCert
+			}
+
+			cert, err := tls.LoadX509KeyPair(p.clientCert, keyFile)
+			if err != nil {
+				return fmt.Errorf("load client certificate: %w", err)
+			}
+
+			tc.Certificates = []tls.Certificate{cert}
+		}
+
+		p.tlsConfig = tc
+	}
+
+	// Cache
+	if p.cacheDir != "" {
+		err := os.MkdirAll(p.cacheDir, 0o755)
+		if err != nil {
+			return fmt.Errorf("create cache directory: %w", err)
+		}
+	}
+
+	// Netrc
+	if p.netrcFile != "" {
+		n, err := readNetrc(p.netrcFile)
+		if err != nil {
+			return fmt.Errorf("read netrc file: %w", err)
+		}
+
+		p.netrc = n
+	}
+
+	// SSH key
+	if p.sshKeyFile != "" {
+		signer, err := readSSHKey(p.sshKeyFile)
+		if err != nil {
+			return fmt.Errorf("read SSH key file: %w", err)
+		}
+
+		p.sshSigners = []ssh.Signer{signer}
+	}
+
+	return nil
+}
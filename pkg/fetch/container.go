@@ -0,0 +1,397 @@
+package fetch
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/flate"
+)
+
+const (
+	magicTar = "ustar"      // Magic bytes for the POSIX and GNU tar formats, at offset 257
+	magicZip = "PK\x03\x04" // Magic bytes for the Zip format (local file header signature)
+
+	// magicZipDataDescriptor is the (optional) signature of Zip data descriptors.
+	magicZipDataDescriptor = "PK\x07\x08"
+
+	// Zip header signatures (https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT)
+	zipLocalHeaderSignature     = 0x04034b50
+	zipDataDescriptorSignature  = 0x08074b50
+	zipCentralHeaderSignature   = 0x02014b50
+	zipEndOfCentralDirSignature = 0x06054b50
+
+	// Zip flags and compression methods
+	zipFlagEncrypted      = 0x0001
+	zipFlagDataDescriptor = 0x0008
+	zipMethodStore        = 0
+	zipMethodDeflate      = 8
+
+	// zipExtraZip64 is the ID of the Zip64 extended information extra field.
+	zipExtraZip64 = 0x0001
+)
+
+// WalkContainer calls fn for each web archive within the tar or Zip container read from r, passing the name of
+// the member (like "crawl/example.warc.gz") and a reader for its (still compressed) content. Other members are
+// skipped. If r is no container, fn is called once for r itself, with an empty name. Containers are read as a
+// stream, so web archives stored in Zip containers without their sizes (using a data descriptor) must be either
+// deflate compressed or uncompressed.
+// Walking stops with an error once the context is canceled.
+func WalkContainer(ctx context.Context, r io.Reader, fn func(name string, r io.Reader) error) error {
+	// Read magic bytes
+	br := bufio.NewReader(r)
+
+	peeked, err := br.Peek(262)
+	if (err != nil) && (err != io.EOF) {
+		return fmt.Errorf("read magic bytes: %w", err)
+	}
+
+	switch {
+	case (len(peeked) >= 262) && (string(peeked[257:262]) == magicTar):
+		// Tar container
+		return walkTar(ctx, br, fn)
+
+	case strings.HasPrefix(string(peeked), magicZip):
+		// Zip container
+		return walkZip(ctx, br, fn)
+
+	default:
+		// No container
+		return fn("", br)
+	}
+}
+
+// walkTar calls fn for each web archive within the tar container read from br.
+func walkTar(ctx context.Context, br *bufio.Reader, fn func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(br)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Read next member header
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+
+		// Skip everything but web archives
+		if (hdr.Typeflag != tar.TypeReg) || !hasExtension(hdr.Name, archiveExtensions) {
+			continue
+		}
+
+		err = fn(hdr.Name, tr)
+		if err != nil {
+			return fmt.Errorf("read tar member [name=%s]: %w", hdr.Name, err)
+		}
+	}
+}
+
+// walkZip calls fn for each web archive within the Zip container read from br. Instead of the central directory
+// at the end, the local file headers are used, so the container can be read as a stream.
+func walkZip(ctx context.Context, br *bufio.Reader, fn func(name string, r io.Reader) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Read signature, the central directory follows the last member
+		var sig [4]byte
+
+		_, err := io.ReadFull(br, sig[:])
+		if err != nil {
+			return fmt.Errorf("read Zip header: %w", err)
+		}
+
+		switch binary.LittleEndian.Uint32(sig[:]) {
+		case zipLocalHeaderSignature:
+		case zipCentralHeaderSignature, zipEndOfCentralDirSignature:
+			return nil
+		default:
+			return fmt.Errorf("invalid Zip header signature [signature=%x]", sig)
+		}
+
+		// Read local file header
+		name, method, flags, size, err := readZipLocalHeader(br)
+		if err != nil {
+			return fmt.Errorf("read Zip header: %w", err)
+		}
+
+		hasDescriptor := flags&zipFlagDataDescriptor != 0
+		isEncrypted := flags&zipFlagEncrypted != 0
+		isArchive := !strings.HasSuffix(name, "/") && hasExtension(name, archiveExtensions)
+
+		// Open member content, other members are skipped as they are
+		var content io.Reader
+		var compressed io.Reader // Remaining compressed data of deflated members with known size
+
+		switch {
+		case hasDescriptor && (method == zipMethodDeflate) && !isEncrypted:
+			// Deflate streams are self-terminating, and read byte by byte from br, so nothing is read beyond
+			content = flate.NewReader(br)
+
+		case hasDescriptor && (!isArchive || ((method == zipMethodStore) && !isEncrypted)):
+			// Other members without size end at their data descriptor
+			content = newZipDescriptorReader(br, (method == zipMethodStore) && !isEncrypted)
+
+		case hasDescriptor && isEncrypted:
+			return fmt.Errorf("encrypted Zip members are not supported [name=%s]", name)
+
+		case hasDescriptor:
+			return fmt.Errorf("unsupported Zip member without size [name=%s, method=%d]", name, method)
+
+		case isArchive && isEncrypted:
+			return fmt.Errorf("encrypted Zip members are not supported [name=%s]", name)
+
+		case isArchive && (method == zipMethodDeflate):
+			compressed = io.LimitReader(br, size)
+			content = flate.NewReader(compressed)
+
+		case isArchive && (method == zipMethodStore):
+			content = io.LimitReader(br, size)
+
+		case isArchive:
+			return fmt.Errorf("unsupported Zip compression method [name=%s, method=%d]", name, method)
+
+		default:
+			content = io.LimitReader(br, size)
+		}
+
+		// Process web archives
+		if isArchive {
+			err = fn(name, content)
+			if err != nil {
+				return fmt.Errorf("read Zip member [name=%s]: %w", name, err)
+			}
+		}
+
+		// Skip remaining content
+		_, err = io.Copy(io.Discard, content)
+		if err != nil {
+			return fmt.Errorf("skip Zip member [name=%s]: %w", name, err)
+		}
+
+		if rc, ok := content.(io.ReadCloser); ok {
+			rc.Close()
+		}
+
+		// Skip compressed data following the end of the deflate stream
+		if compressed != nil {
+			_, err = io.Copy(io.Discard, compressed)
+			if err != nil {
+				return fmt.Errorf("skip Zip member [name=%s]: %w", name, err)
+			}
+		}
+
+		if _, ok := content.(*zipDescriptorReader); ok || !hasDescriptor {
+			continue
+		}
+
+		// Skip data descriptor: optional signature, CRC-32, and sizes
+		err = skipZipDataDescriptor(br)
+		if err != nil {
+			return fmt.Errorf("read Zip data descriptor [name=%s]: %w", name, err)
+		}
+	}
+}
+
+// readZipLocalHeader reads the Zip local file header following its signature from br, returning the name,
+// compression method, flags, and compressed size of the member.
+func readZipLocalHeader(br *bufio.Reader) (string, uint16, uint16, int64, error) {
+	var hdr [26]byte
+
+	_, err := io.ReadFull(br, hdr[:])
+	if err != nil {
+		return "", 0, 0, 0, err
+	}
+
+	flags := binary.LittleEndian.Uint16(hdr[2:4])
+	method := binary.LittleEndian.Uint16(hdr[4:6])
+	compressedSize := uint64(binary.LittleEndian.Uint32(hdr[14:18]))
+	uncompressedSize := uint64(binary.LittleEndian.Uint32(hdr[18:22]))
+	nameLen := binary.LittleEndian.Uint16(hdr[22:24])
+	extraLen := binary.LittleEndian.Uint16(hdr[24:26])
+
+	// Read name and extra fields
+	buf := make([]byte, int(nameLen)+int(extraLen))
+
+	_, err = io.ReadFull(br, buf)
+	if err != nil {
+		return "", 0, 0, 0, err
+	}
+
+	name, extra := string(buf[:nameLen]), buf[nameLen:]
+
+	// Take sizes from the Zip64 extra field, if any. It only contains the sizes that don't fit the header.
+	for len(extra) >= 4 {
+		id, n := binary.LittleEndian.Uint16(extra[0:2]), int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+n {
+			break
+		}
+
+		field := extra[4 : 4+n]
+		extra = extra[4+n:]
+
+		if id != zipExtraZip64 {
+			continue
+		}
+
+		if (uncompressedSize == 0xffffffff) && (len(field) >= 8) {
+			uncompressedSize = binary.LittleEndian.Uint64(field[0:8])
+			field = field[8:]
+		}
+
+		if (compressedSize == 0xffffffff) && (len(field) >= 8) {
+			compressedSize = binary.LittleEndian.Uint64(field[0:8])
+		}
+	}
+
+	if compressedSize > 1<<62 {
+		return "", 0, 0, 0, errors.New("invalid compressed size")
+	}
+
+	return name, method, flags, int64(compressedSize), nil
+}
+
+// skipZipDataDescriptor skips the Zip data descriptor at the current position of br. As the descriptor doesn't
+// tell whether it uses 32 or 64 bit sizes, 32 bit sizes are assumed if they are followed by another header.
+func skipZipDataDescriptor(br *bufio.Reader) error {
+	peeked, err := br.Peek(4 + 4 + 16 + 4)
+	if (err != nil) && (err != io.EOF) {
+		return err
+	}
+
+	// Signature is optional
+	n := 0
+	if (len(peeked) >= 4) && (binary.LittleEndian.Uint32(peeked) == zipDataDescriptorSignature) {
+		n = 4
+	}
+
+	// CRC-32 and sizes
+	n += 4 + 8
+
+	if len(peeked) >= n+4 {
+		switch binary.LittleEndian.Uint32(peeked[n:]) {
+		case zipLocalHeaderSignature, zipCentralHeaderSignature, zipEndOfCentralDirSignature:
+		default:
+			n += 8
+		}
+	}
+
+	_, err = br.Discard(n)
+	return err
+}
+
+// zipDescriptorReader reads the content of a Zip member without size up to its data descriptor, which is
+// consumed as well. The descriptor is found by its signature, which is optional in general but required here.
+// As the signature may also be part of the content, the descriptor must match the content read so far: its
+// compressed size must match, as well as its CRC-32 for uncompressed (stored) members.
+type zipDescriptorReader struct {
+	br       *bufio.Reader
+	checkCRC bool   // Set if the CRC-32 of the content can be checked (stored members)
+	size     uint64 // Size of the content read so far
+	crc      uint32 // CRC-32 of the content read so far
+	done     bool   // Set once the data descriptor got consumed
+}
+
+// newZipDescriptorReader returns a reader for the content of a Zip member without size read from br, checking
+// the CRC-32 of the data descriptor (if checkCRC is set).
+func newZipDescriptorReader(br *bufio.Reader, checkCRC bool) *zipDescriptorReader {
+	return &zipDescriptorReader{br: br, checkCRC: checkCRC}
+}
+
+// Read reads up to len(p) bytes into p.
+func (zr *zipDescriptorReader) Read(p []byte) (int, error) {
+	if zr.done {
+		return 0, io.EOF
+	}
+
+	// Look ahead far enough to see a full data descriptor and the following signature
+	buf, err := zr.br.Peek(max(zr.br.Buffered(), 4+4+16+4))
+	if (err != nil) && (err != io.EOF) {
+		return 0, err
+	}
+
+	// Data descriptor at current position?
+	sig := []byte(magicZipDataDescriptor)
+	skip := 0
+
+	if bytes.HasPrefix(buf, sig) {
+		if l := zr.descriptorLen(buf); l > 0 {
+			zr.done = true
+
+			_, err = zr.br.Discard(l)
+			if err != nil {
+				return 0, err
+			}
+
+			return 0, io.EOF
+		}
+
+		// Signature is part of the content
+		skip = 1
+	}
+
+	// Content up to the next possible signature, which may also start within the last bytes of the buffer
+	i := bytes.Index(buf[skip:], sig)
+
+	switch {
+	case i >= 0:
+		buf = buf[:skip+i]
+
+	case err == io.EOF:
+		// Content ends without data descriptor
+		return 0, io.ErrUnexpectedEOF
+
+	default:
+		buf = buf[:max(skip, len(buf)-len(sig)+1)]
+	}
+
+	n := copy(p, buf)
+
+	zr.size += uint64(n)
+	zr.crc = crc32.Update(zr.crc, crc32.IEEETable, buf[:n])
+
+	_, err = zr.br.Discard(n)
+	return n, err
+}
+
+// descriptorLen returns the length of the data descriptor at the start of buf (including its signature) if it
+// matches the content read so far, or zero otherwise. As the descriptor doesn't tell whether it uses 32 or 64 bit
+// sizes, 32 bit sizes are assumed if they are followed by another header.
+func (zr *zipDescriptorReader) descriptorLen(buf []byte) int {
+	if (len(buf) < 16) || (zr.checkCRC && (binary.LittleEndian.Uint32(buf[4:8]) != zr.crc)) {
+		return 0
+	}
+
+	is32 := uint64(binary.LittleEndian.Uint32(buf[8:12])) == zr.size
+	is64 := (len(buf) >= 24) && (binary.LittleEndian.Uint64(buf[8:16]) == zr.size)
+
+	if is32 && (len(buf) >= 20) {
+		switch binary.LittleEndian.Uint32(buf[16:20]) {
+		case zipLocalHeaderSignature, zipCentralHeaderSignature, zipEndOfCentralDirSignature:
+			return 16
+		}
+	}
+
+	switch {
+	case is64:
+		return 24
+	case is32:
+		return 16
+	default:
+		return 0
+	}
+}
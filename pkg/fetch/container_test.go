@@ -0,0 +1,277 @@
+package fetch
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// containerMember is a member of a container built for tests.
+type containerMember struct {
+	name    string
+	content string
+	method  uint16
+}
+
+// buildZip returns a Zip container with the given members, written as a stream (with data descriptors).
+func buildZip(t *testing.T, members []containerMember) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for _, m := range members {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: m.name, Method: m.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = io.WriteString(w, m.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// buildSizedZip returns a Zip container with the given members, with sizes in the local file headers (without data
+// descriptors). The compressed data of deflated members is followed by the given padding, which is not part of the
+// deflate stream.
+func buildSizedZip(t *testing.T, members []containerMember, padding string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for _, m := range members {
+		data := []byte(m.content)
+
+		if m.method == zip.Deflate {
+			var cbuf bytes.Buffer
+
+			fw, err := flate.NewWriter(&cbuf, flate.DefaultCompression)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _ = io.WriteString(fw, m.content)
+			fw.Close()
+
+			data = append(cbuf.Bytes(), padding...)
+		}
+
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               m.name,
+			Method:             m.method,
+			CRC32:              crc32.ChecksumIEEE([]byte(m.content)),
+			CompressedSize64:   uint64(len(data)),
+			UncompressedSize64: uint64(len(m.content)),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = w.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// buildTar returns a tar container with the given members.
+func buildTar(t *testing.T, members []containerMember) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+
+	for _, m := range members {
+		err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = io.WriteString(tw, m.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// walkAll walks the container in data, returning the names and contents of all members passed to fn.
+func walkAll(data []byte) (map[string]string, error) {
+	got := map[string]string{}
+
+	err := WalkContainer(context.Background(), bytes.NewReader(data), func(name string, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		got[name] = string(content)
+
+		return err
+	})
+
+	return got, err
+}
+
+func TestWalkContainer(t *testing.T) {
+	warc := "WARC/1.0\r\nWARC-Type: response\r\n\r\n" + strings.Repeat("content ", 1000)
+	signature := "before PK\x07\x08 after"
+
+	tests := []struct {
+		name    string
+		data    func(t *testing.T) []byte
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "no container",
+			data: func(_ *testing.T) []byte { return []byte(warc) },
+			want: map[string]string{"": warc},
+		},
+		{
+			name: "tar",
+			data: func(t *testing.T) []byte {
+				return buildTar(t, []containerMember{
+					{name: "README.txt", content: "readme"},
+					{name: "crawl/a.warc.gz", content: warc},
+					{name: "crawl/b.warc", content: "b"},
+				})
+			},
+			want: map[string]string{"crawl/a.warc.gz": warc, "crawl/b.warc": "b"},
+		},
+		{
+			name: "zip deflated",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []containerMember{
+					{name: "crawl/a.warc.gz", content: warc, method: zip.Deflate},
+					{name: "notes.txt", content: "notes", method: zip.Deflate},
+				})
+			},
+			want: map[string]string{"crawl/a.warc.gz": warc},
+		},
+		{
+			name: "zip with stored non-archive member",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []containerMember{
+					{name: "README.txt", content: "readme", method: zip.Store},
+					{name: "crawl/a.warc.gz", content: warc, method: zip.Deflate},
+				})
+			},
+			want: map[string]string{"crawl/a.warc.gz": warc},
+		},
+		{
+			name: "zip with stored archive members",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []containerMember{
+					{name: "a.warc", content: warc, method: zip.Store},
+					{name: "b.warc", content: "", method: zip.Store},
+					{name: "c.warc", content: "c", method: zip.Deflate},
+				})
+			},
+			want: map[string]string{"a.warc": warc, "b.warc": "", "c.warc": "c"},
+		},
+		{
+			name: "zip with descriptor signature within stored content",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []containerMember{
+					{name: "skipped.bin", content: signature, method: zip.Store},
+					{name: "a.warc", content: signature, method: zip.Store},
+					{name: "b.warc", content: "b", method: zip.Store},
+				})
+			},
+			want: map[string]string{"a.warc": signature, "b.warc": "b"},
+		},
+		{
+			name: "zip with directory",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []containerMember{
+					{name: "crawl.warc/", method: zip.Store},
+					{name: "crawl.warc/a.warc", content: "a", method: zip.Deflate},
+				})
+			},
+			want: map[string]string{"crawl.warc/a.warc": "a"},
+		},
+		{
+			name: "zip with sizes",
+			data: func(t *testing.T) []byte {
+				return buildSizedZip(t, []containerMember{
+					{name: "README.txt", content: "readme", method: zip.Deflate},
+					{name: "a.warc", content: warc, method: zip.Deflate},
+					{name: "b.warc", content: "b", method: zip.Store},
+				}, "")
+			},
+			want: map[string]string{"a.warc": warc, "b.warc": "b"},
+		},
+		{
+			name: "zip with sizes and padded deflate streams",
+			data: func(t *testing.T) []byte {
+				return buildSizedZip(t, []containerMember{
+					{name: "README.txt", content: "readme", method: zip.Deflate},
+					{name: "a.warc", content: warc, method: zip.Deflate},
+					{name: "b.warc", content: "b", method: zip.Deflate},
+				}, strings.Repeat("\x00", 16*1024))
+			},
+			want: map[string]string{"a.warc": warc, "b.warc": "b"},
+		},
+		{
+			name: "zip truncated",
+			data: func(t *testing.T) []byte {
+				data := buildZip(t, []containerMember{{name: "a.warc", content: warc, method: zip.Store}})
+				return data[:len(data)/2]
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := walkAll(tt.data(t))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("WalkContainer() succeeded, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("WalkContainer() failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WalkContainer() members = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
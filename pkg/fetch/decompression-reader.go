@@ -4,64 +4,212 @@ import (
 	"bufio"
 	"compress/bzip2"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/ulikunitz/xz"
 )
 
+// Compression is a compression format of NewDecompressionReader.
+type Compression string
+
+const (
+	CompressionAuto   Compression = "auto"   // Detect compression format by magic bytes or file name (default)
+	CompressionNone   Compression = "none"   // No compression
+	CompressionGZip   Compression = "gzip"   // GZip
+	CompressionBZip2  Compression = "bzip2"  // BZip2
+	CompressionXZ     Compression = "xz"     // XZ
+	CompressionZStd   Compression = "zstd"   // ZStd
+	CompressionBrotli Compression = "brotli" // Brotli
+	CompressionLZ4    Compression = "lz4"    // LZ4 frame format
+	CompressionSnappy Compression = "snappy" // Snappy framing format (or S2)
+)
+
+// Compressions are all supported compression formats.
+var Compressions = []Compression{
+	CompressionAuto,
+	CompressionNone,
+	CompressionGZip,
+	CompressionBZip2,
+	CompressionXZ,
+	CompressionZStd,
+	CompressionBrotli,
+	CompressionLZ4,
+	CompressionSnappy,
+}
+
 const (
 	magicGZip               = "\x1f\x8b"                 // Magic bytes for the Gzip format (RFC 1952, section 2.3.1)
 	magicBZip2              = "\x42\x5a"                 // Magic bytes for the BZip2 format (no formal spec exists)
 	magicXZ                 = "\xfd\x37\x7a\x58\x5a\x00" // Magic bytes for the XZ format (https://tukaani.org/xz/xz-file-format.txt)
 	magicZStdFrame          = "\x28\xb5\x2f\xfd"         // Magic bytes for the ZStd frame format (RFC 8478, section 3.1.1)
 	magicZStdSkippableFrame = "\x2a\x4d\x18"             // Magic bytes for the ZStd skippable frame format (RFC 8478, section 3.1.2)
+	magicLZ4Frame           = "\x04\x22\x4d\x18"         // Magic bytes for the LZ4 frame format (https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md)
+	magicSnappyFrame        = "\xff\x06\x00\x00sNaPpY"   // Stream identifier of the Snappy framing format (https://github.com/google/snappy/blob/main/framing_format.txt)
+	magicS2Frame            = "\xff\x06\x00\x00S2sTwO"   // Stream identifier of the S2 framing format (a Snappy extension)
+
+	// extBrotli is the file name extension of Brotli compressed files, which have no magic bytes.
+	extBrotli = ".br"
 )
 
-// NewDecompressionReader will return a new reader transparently doing decompression of GZip, BZip2, XZ, and
-// ZStd.
-func NewDecompressionReader(r io.ReadCloser) (io.ReadCloser, error) {
-	// Read magic bytes
-	br := bufio.NewReader(r)
+// decompressionParams wraps all parameters of NewDecompressionReader.
+type decompressionParams struct {
+	compression Compression
+	name        string
+}
 
-	magic, err := br.Peek(6)
-	if err != nil {
-		if err == io.EOF {
-			return io.NopCloser(br), nil
+// DecompressionOption is an option of NewDecompressionReader.
+type DecompressionOption func(*decompressionParams)
+
+// WithCompression sets the compression format, instead of detecting it. Defaults to CompressionAuto.
+func WithCompression(compression Compression) DecompressionOption {
+	return func(p *decompressionParams) {
+		p.compression = compression
+	}
+}
+
+// WithFileName sets the file name (or URL) of the input, which is used to detect compression formats without
+// magic bytes (like Brotli, by its ".br" extension).
+func WithFileName(name string) DecompressionOption {
+	return func(p *decompressionParams) {
+		p.name = name
+	}
+}
+
+// ReadSeekerAt is implemented by inputs that allow random access, like *os.File. Wrappers of content readers
+// should retain it, so seekable ZStd streams can be decoded in parallel.
+type ReadSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// NewDecompressionReader will return a new reader transparently doing decompression of GZip, BZip2, XZ, ZStd,
+// LZ4, and Snappy, which are detected by their magic bytes, as well as Brotli, which is detected by the ".br"
+// extension of the file name (if given). The compression format can also be set explicitly. If r allows random
+// access and contains a ZStd stream in the seekable format, frames are decoded in parallel.
+func NewDecompressionReader(r io.ReadCloser, opts ...DecompressionOption) (io.ReadCloser, error) {
+	params := &decompressionParams{compression: CompressionAuto}
+
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	// Use parallel decoding for seekable ZStd, if possible
+	if rs, ok := r.(ReadSeekerAt); ok && ((params.compression == CompressionAuto) || (params.compression == CompressionZStd)) {
+		if zr := openSeekableZStd(rs); zr != nil {
+			zr.closer = r
+			return zr, nil
 		}
+	}
 
+	// Read magic bytes, shorter inputs can't be compressed
+	br := bufio.NewReader(r)
+
+	peeked, err := br.Peek(10)
+	if (err != nil) && (err != io.EOF) {
 		return nil, fmt.Errorf("read magic bytes: %w", err)
 	}
 
-	switch {
-	case string(magic[0:2]) == magicGZip:
+	magic := string(peeked)
+
+	// Detect compression format
+	compression := params.compression
+
+	if compression == CompressionAuto {
+		compression = detectCompression(magic, params.name)
+	}
+
+	switch compression {
+	case CompressionGZip:
 		// GZIP decompression
 		return decompressGZip(br)
 
-	case string(magic[0:2]) == magicBZip2:
+	case CompressionBZip2:
 		// BZIP2 decompression
 		return decompressBzip2(br)
 
-	case string(magic[0:6]) == magicXZ:
+	case CompressionXZ:
 		// XZ decompression
 		return decompressXZ(br)
 
-	case string(magic[0:4]) == magicZStdFrame:
-		// ZStd decompression
+	case CompressionZStd:
+		// ZStd decompression, with custom dictionary if it starts with a skippable frame
+		if isZStdSkippableFrame(magic) {
+			return decompressZStdCustomDict(br)
+		}
+
 		return decompressZStd(br)
 
-	case (string(magic[1:4]) == magicZStdSkippableFrame) && (magic[0]&0xf0 == 0x50):
-		// ZStd decompression with custom dictionary
-		return decompressZStdCustomDict(br)
+	case CompressionBrotli:
+		// Brotli decompression
+		return decompressBrotli(br)
 
-	default:
+	case CompressionLZ4:
+		// LZ4 decompression
+		return decompressLZ4(br)
+
+	case CompressionSnappy:
+		// Snappy decompression
+		return decompressSnappy(br)
+
+	case CompressionNone:
 		// Use no decompression
 		return io.NopCloser(br), nil
+
+	case CompressionAuto:
+		// Resolved by detectCompression above, never reached
+		return nil, errors.New("compression format not detected")
+
+	default:
+		return nil, fmt.Errorf("unknown compression format [compression=%s]", compression)
 	}
 }
 
+// detectCompression returns the compression format of a stream starting with the given magic bytes, falling
+// back to the extension of its file name (or URL) for formats without magic bytes.
+func detectCompression(magic string, name string) Compression {
+	switch {
+	case strings.HasPrefix(magic, magicGZip):
+		return CompressionGZip
+
+	case strings.HasPrefix(magic, magicBZip2):
+		return CompressionBZip2
+
+	case strings.HasPrefix(magic, magicXZ):
+		return CompressionXZ
+
+	case strings.HasPrefix(magic, magicZStdFrame):
+		return CompressionZStd
+
+	case isZStdSkippableFrame(magic):
+		return CompressionZStd
+
+	case strings.HasPrefix(magic, magicLZ4Frame):
+		return CompressionLZ4
+
+	case strings.HasPrefix(magic, magicSnappyFrame) || strings.HasPrefix(magic, magicS2Frame):
+		return CompressionSnappy
+	}
+
+	// Strip query and fragment of URLs
+	if i := strings.IndexAny(name, "?#"); (i >= 0) && strings.Contains(name, "://") {
+		name = name[:i]
+	}
+
+	if strings.HasSuffix(strings.ToLower(name), extBrotli) {
+		return CompressionBrotli
+	}
+
+	return CompressionNone
+}
+
 // decompressGZip decompresses a GZip stream from the given input reader r.
 func decompressGZip(br *bufio.Reader) (io.ReadCloser, error) {
 	// Open GZip reader
@@ -95,7 +243,7 @@ func decompressXZ(br *bufio.Reader) (io.ReadCloser, error) {
 // decompressZStd decompresses a ZStd stream from the given input reader r.
 func decompressZStd(br *bufio.Reader) (io.ReadCloser, error) {
 	// Open ZStd reader
-	dr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+	dr, err := zstd.NewReader(br)
 	if err != nil {
 		return nil, fmt.Errorf("read ZStd stream: %w", err)
 	}
@@ -103,48 +251,134 @@ func decompressZStd(br *bufio.Reader) (io.ReadCloser, error) {
 	return dr.IOReadCloser(), nil
 }
 
+// decompressBrotli decompresses a Brotli stream from the given input reader r.
+func decompressBrotli(br *bufio.Reader) (io.ReadCloser, error) {
+	// Open Brotli reader
+	dr := brotli.NewReader(br)
+
+	return io.NopCloser(dr), nil
+}
+
+// decompressLZ4 decompresses an LZ4 frame stream from the given input reader r.
+func decompressLZ4(br *bufio.Reader) (io.ReadCloser, error) {
+	// Open LZ4 reader
+	dr := lz4.NewReader(br)
+
+	return io.NopCloser(dr), nil
+}
+
+// decompressSnappy decompresses a Snappy (or S2) framed stream from the given input reader r.
+func decompressSnappy(br *bufio.Reader) (io.ReadCloser, error) {
+	// Open S2 reader, which also reads Snappy streams
+	dr := s2.NewReader(br)
+
+	return io.NopCloser(dr), nil
+}
+
+// openSeekableZStd returns a reader for the seekable ZStd stream rs, or nil if rs does not contain a seekable
+// ZStd stream that can be decoded in parallel. The read offset of rs is left untouched in the latter case.
+func openSeekableZStd(rs ReadSeekerAt) *SeekableZStdReader {
+	// Only consider streams that have not been read from yet
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if (err != nil) || (pos != 0) {
+		return nil
+	}
+
+	// Determine size
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil
+	}
+
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil
+	}
+
+	// Check magic bytes
+	var magic [4]byte
+
+	_, err = rs.ReadAt(magic[:], 0)
+	if (err != nil) || ((string(magic[:]) != magicZStdFrame) && !isZStdSkippableFrame(string(magic[:]))) {
+		return nil
+	}
+
+	// Read seek table, fall back to sequential decoding on any error
+	zr, err := NewSeekableZStdReader(rs, size)
+	if err != nil {
+		return nil
+	}
+
+	// Fall back to sequential decoding if frames are too big
+	for _, f := range zr.frames {
+		if f.decompressedSize > maxZStdSeekableFrameSize {
+			zr.Close()
+			return nil
+		}
+	}
+
+	return zr
+}
+
 // decompressZStdCustomDict decompresses a ZStd stream with a prefixed custom dictionary from the given input
 // reader r.
 func decompressZStdCustomDict(br *bufio.Reader) (io.ReadCloser, error) {
+	// Read custom dictionary
+	dict, _, err := readZStdCustomDict(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open ZStd reader, with the given dictionary
+	dr, err := zstd.NewReader(br, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		return nil, fmt.Errorf("create ZStd reader: %w", err)
+	}
+
+	return dr.IOReadCloser(), nil
+}
+
+// readZStdCustomDict reads the skippable frame holding a ZStd compressed custom dictionary (as prepended by
+// megawarc) from r, returning the dictionary and the size of the frame.
+func readZStdCustomDict(r io.Reader) ([]byte, int64, error) {
 	// Read header
 	var header [8]byte
 
-	_, err := br.Read(header[:])
+	_, err := io.ReadFull(r, header[:])
 	if err != nil {
-		return nil, fmt.Errorf("read ZStd skippable frame header: %w", err)
+		return nil, 0, fmt.Errorf("read ZStd skippable frame header: %w", err)
 	}
 
-	magic, length := header[0:4], binary.LittleEndian.Uint32(header[4:8])
-	if (string(magic[1:4]) != magicZStdSkippableFrame) || (magic[0]&0xf0 != 0x50) {
-		return nil, fmt.Errorf("expected ZStd skippable frame header")
+	length := binary.LittleEndian.Uint32(header[4:8])
+	if !isZStdSkippableFrame(string(header[0:4])) {
+		return nil, 0, fmt.Errorf("expected ZStd skippable frame header")
 	}
 
 	// Read ZStd compressed custom dictionary
-	lr := io.LimitReader(br, int64(length))
+	lr := io.LimitReader(r, int64(length))
 
 	dictr, err := zstd.NewReader(lr)
 	if err != nil {
-		return nil, fmt.Errorf("read ZStd compressed custom dictionary: %w", err)
+		return nil, 0, fmt.Errorf("read ZStd compressed custom dictionary: %w", err)
 	}
 
 	defer dictr.Close()
 
 	dict, err := io.ReadAll(dictr)
 	if err != nil {
-		return nil, fmt.Errorf("read ZStd compressed custom dictionary: %w", err)
+		return nil, 0, fmt.Errorf("read ZStd compressed custom dictionary: %w", err)
 	}
 
 	// Discard remaining bytes, if any
 	_, err = io.Copy(io.Discard, lr)
 	if err != nil {
-		return nil, fmt.Errorf("discard remaining bytes of ZStd compressed custom dictionary: %w", err)
+		return nil, 0, fmt.Errorf("discard remaining bytes of ZStd compressed custom dictionary: %w", err)
 	}
 
-	// Open ZStd reader, with the given dictionary
-	dr, err := zstd.NewReader(br, zstd.WithDecoderDicts(dict), zstd.WithDecoderConcurrency(1))
-	if err != nil {
-		return nil, fmt.Errorf("create ZStd reader: %w", err)
-	}
+	return dict, int64(len(header)) + int64(length), nil
+}
 
-	return dr.IOReadCloser(), nil
+// isZStdSkippableFrame returns true if magic starts with the magic bytes of a ZStd skippable frame.
+func isZStdSkippableFrame(magic string) bool {
+	return (len(magic) >= 4) && (magic[1:4] == magicZStdSkippableFrame) && (magic[0]&0xf0 == 0x50)
 }
@@ -0,0 +1,158 @@
+package fetch
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// compressSample returns the content compressed by the writer returned by newWriter.
+func compressSample(t *testing.T, content string, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := newWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.Write([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// TestNewDecompressionReader tests detecting compression formats by their magic bytes or by file name.
+func TestNewDecompressionReader(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("WARC-Type: response\r\n", 20)
+
+	gzipData := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })
+	xzData := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })
+	zstdData := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })
+	lz4Data := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil })
+	s2Data := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return s2.NewWriter(w), nil })
+	brotliData := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil })
+
+	snappyData := compressSample(t, content, func(w io.Writer) (io.WriteCloser, error) {
+		return s2.NewWriter(w, s2.WriterSnappyCompat()), nil
+	})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    []DecompressionOption
+		want    string
+		wantErr bool
+	}{
+		{name: "uncompressed", data: []byte(content), want: content},
+		{name: "short uncompressed", data: []byte("WARC"), want: "WARC"},
+		{name: "empty", data: nil, want: ""},
+		{name: "GZip", data: gzipData, want: content},
+		{name: "XZ", data: xzData, want: content},
+		{name: "ZStd", data: zstdData, want: content},
+		{name: "LZ4", data: lz4Data, want: content},
+		{name: "Snappy", data: snappyData, want: content},
+		{name: "S2", data: s2Data, want: content},
+		{
+			name: "magic bytes over file name",
+			data: lz4Data,
+			opts: []DecompressionOption{WithFileName("example.warc.br")},
+			want: content,
+		},
+		{
+			name: "Brotli by file name",
+			data: brotliData,
+			opts: []DecompressionOption{WithFileName("/data/example.warc.BR")},
+			want: content,
+		},
+		{
+			name: "Brotli by URL with query",
+			data: brotliData,
+			opts: []DecompressionOption{WithFileName("https://example.com/example.warc.br?sig=abc&expires=1")},
+			want: content,
+		},
+		{
+			name: "Brotli by URL with fragment",
+			data: brotliData,
+			opts: []DecompressionOption{WithFileName("https://example.com/example.warc.br#part")},
+			want: content,
+		},
+		{
+			name: "Brotli without file name",
+			data: brotliData,
+			want: string(brotliData),
+		},
+		{
+			name: "Brotli with other extension in query",
+			data: brotliData,
+			opts: []DecompressionOption{WithFileName("https://example.com/example.warc?name=example.warc.br")},
+			want: string(brotliData),
+		},
+		{
+			name: "Brotli by compression",
+			data: brotliData,
+			opts: []DecompressionOption{WithCompression(CompressionBrotli)},
+			want: content,
+		},
+		{
+			name: "compression over magic bytes",
+			data: gzipData,
+			opts: []DecompressionOption{WithCompression(CompressionNone)},
+			want: string(gzipData),
+		},
+		{
+			name: "compression over file name",
+			data: []byte(content),
+			opts: []DecompressionOption{WithCompression(CompressionNone), WithFileName("example.warc.br")},
+			want: content,
+		},
+		{
+			name:    "compression mismatch",
+			data:    []byte(content),
+			opts:    []DecompressionOption{WithCompression(CompressionGZip)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown compression",
+			data:    gzipData,
+			opts:    []DecompressionOption{WithCompression("rar")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dr, err := NewDecompressionReader(io.NopCloser(bytes.NewReader(tt.data)), tt.opts...)
+			if err == nil {
+				defer dr.Close()
+
+				var got []byte
+
+				got, err = io.ReadAll(dr)
+				if (err == nil) && (string(got) != tt.want) {
+					t.Errorf("ReadAll() = %q, want %q", got, tt.want)
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDecompressionReader() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// archiveExtensions are the file extensions of (uncompressed) web archives.
+	archiveExtensions = []string{".warc", ".wat", ".wet", ".arc"}
+
+	// containerExtensions are the file extensions of supported containers of web archives.
+	containerExtensions = []string{".tar", ".tgz", ".zip"}
+
+	// compressionExtensions are the file extensions of supported compression formats.
+	compressionExtensions = []string{".gz", ".bz2", ".xz", ".zst", ".zstd", ".br", ".lz4", ".sz", ".snappy"}
+)
+
+// Expand expands address addr into the list of addresses of all archives it refers to, using the given options.
+// Amazon S3 URLs ending with a slash ("s3://bucket/prefix/") are expanded to all archives below the prefix,
+// and Amazon S3 URLs containing glob patterns ("s3://bucket/segments/*/warc/*.warc.gz") are expanded to all
+// objects matching the pattern. Local directories are expanded to all archives below them (recursively), and
+// local paths containing glob patterns ("/data/crawls/**/*.warc.gz") are expanded to all matching files (or to
+// all archives below matching directories). Internet Archive items ("ia://item") and Common Crawl crawls
+// ("cc://CC-MAIN-2023-50/warc") are expanded to all of their archives, and registered schemes may expand
+// addresses via Expander. All other addresses are returned as they are.
+//
+// Glob patterns follow the syntax of path.Match for each path segment, with the addition of "**" matching any
+// number of segments. In URLs, the "?" wildcard must be escaped as "%3F", as it would start the URL query. Local
+// paths that exist are never taken as glob patterns, and local glob patterns matching nothing are an error.
+// Expanding is aborted once the context is canceled.
+func Expand(ctx context.Context, addr string, opts ...Option) ([]string, error) {
+	// Early exit on STDIN
+	if (addr == "") || (addr == "-") {
+		return []string{addr}, nil
+	}
+
+	// Bootstrap params, which also reports invalid options early on
+	params, err := newParams(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse URL
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse URL: %w", err)
+	}
+
+	// Pick proper expansion strategy
+	switch u.Scheme {
+	case "s3":
+		// Amazon S3
+		return expandS3URL(ctx, u, params)
+
+	case "ia":
+		// Internet Archive item
+		return expandIAURL(ctx, u, params)
+
+	case "cc":
+		// Common Crawl crawl
+		return expandCCURL(ctx, u, params, opts)
+
+	case "file", "":
+		// File URL or plain path
+		return expandFileURL(ctx, addr, u)
+
+	default:
+		// Registered scheme that expands addresses itself
+		if opener, ok := registeredScheme(u.Scheme); ok {
+			if expander, ok := opener.(Expander); ok {
+				return expander.Expand(ctx, u)
+			}
+		}
+
+		// Single object
+		return []string{addr}, nil
+	}
+}
+
+// expandFileURL expands the given file URL (or plain path) into the files of all archives below it (if it is a
+// directory) or all files matching its glob pattern (if any). Expanded addresses are of the same kind as u.
+func expandFileURL(ctx context.Context, addr string, u *url.URL) ([]string, error) {
+	// Get path from URL. Plain paths are taken as they are, as "?" is a glob meta character there.
+	p := addr
+
+	if u.Scheme == "file" {
+		var err error
+
+		p, err = pathFromURL(u)
+		if err != nil {
+			return nil, fmt.Errorf("file expand [url=%s]: %w", u.String(), err)
+		}
+	}
+
+	// Find matching files and directories. Existing paths are taken literally, even if they contain glob meta
+	// characters (like "[").
+	matches := []string{p}
+
+	if _, err := os.Stat(p); (err != nil) && hasGlob(filepath.ToSlash(p)) {
+		matches, err = globFiles(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("file expand [url=%s]: %w", u.String(), err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match glob pattern [pattern=%s]", p)
+		}
+	}
+
+	// Walk directories
+	var paths []string
+
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			if (len(matches) == 1) && (m == p) {
+				// Let opening the file fail
+				return []string{addr}, nil
+			}
+
+			return nil, fmt.Errorf("file expand [url=%s]: %w", u.String(), err)
+		}
+
+		if !fi.IsDir() {
+			paths = append(paths, m)
+			continue
+		}
+
+		err = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if d.Type().IsRegular() && isArchiveName(d.Name()) {
+				paths = append(paths, path)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("file expand [url=%s]: %w", u.String(), err)
+		}
+	}
+
+	// Convert back to file URLs, if necessary
+	if u.Scheme == "file" {
+		for i, p := range paths {
+			paths[i] = (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+		}
+	}
+
+	return paths, nil
+}
+
+// globFiles returns all files and directories matching the glob pattern, sorted by name.
+func globFiles(ctx context.Context, pattern string) ([]string, error) {
+	if err := checkGlob(filepath.ToSlash(pattern)); err != nil {
+		return nil, err
+	}
+
+	// Without "**", only a single level is matched for each segment
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	// Otherwise walk everything below the literal prefix
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	i := 0
+	for (i < len(segments)) && !hasGlob(segments[i]) {
+		i++
+	}
+
+	root := filepath.FromSlash(strings.Join(segments[:i], "/"))
+	if (root == "") && (i > 0) {
+		root = string(filepath.Separator)
+	} else if root == "" {
+		root = "."
+	}
+
+	var matches []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if (err != nil) || (rel == ".") {
+			return err
+		}
+
+		if matchGlob(segments[i:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path)
+
+			if d.IsDir() {
+				// Matched directories are walked later on
+				return fs.SkipDir
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// hasGlob returns true if the pattern contains any glob meta characters.
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// checkGlob returns an error if any segment of the pattern is malformed.
+func checkGlob(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern [pattern=%s]: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchGlob returns true if the slash-separated name matches the glob pattern, both given as segments. The
+// pattern must have been checked using checkGlob.
+func matchGlob(pattern []string, name []string) bool {
+	// Both exhausted
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	// Any number of segments
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Single segment
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchGlob(pattern[1:], name[1:])
+}
+
+// isArchiveName returns true if the name looks like the name of a (possibly compressed) web archive, like
+// "example.warc.gz" or "example.megawarc.warc.zst", or of a container of web archives, like "example.tar.gz".
+func isArchiveName(name string) bool {
+	return hasExtension(name, archiveExtensions) || hasExtension(name, containerExtensions)
+}
+
+// hasExtension returns true if the name ends with one of the given extensions, ignoring extensions of
+// compression formats.
+func hasExtension(name string, extensions []string) bool {
+	name = strings.ToLower(name)
+
+	for _, ext := range compressionExtensions {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
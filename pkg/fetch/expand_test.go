@@ -0,0 +1,149 @@
+package fetch
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMatchGlob tests matching slash-separated names against glob patterns.
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "a.warc.gz", name: "a.warc.gz", want: true},
+		{pattern: "*.warc.gz", name: "a.warc.gz", want: true},
+		{pattern: "*.warc.gz", name: "dir/a.warc.gz", want: false},
+		{pattern: "?.warc", name: "a.warc", want: true},
+		{pattern: "?.warc", name: "ab.warc", want: false},
+		{pattern: "[ab].warc", name: "b.warc", want: true},
+		{pattern: "[^ab].warc", name: "b.warc", want: false},
+		{pattern: "*/warc/*", name: "seg/warc/a.warc.gz", want: true},
+		{pattern: "*/warc/*", name: "seg/wet/a.warc.gz", want: false},
+		{pattern: "**", name: "a/b/c.warc", want: true},
+		{pattern: "**/*.warc", name: "a.warc", want: true},
+		{pattern: "**/*.warc", name: "a/b/c.warc", want: true},
+		{pattern: "**/*.warc", name: "a/b/c.wet", want: false},
+		{pattern: "a/**/c.warc", name: "a/c.warc", want: true},
+		{pattern: "a/**/c.warc", name: "a/x/y/c.warc", want: true},
+		{pattern: "a/**/c.warc", name: "b/x/c.warc", want: false},
+		{pattern: "a/**/**/c.warc", name: "a/x/c.warc", want: true},
+		{pattern: "a/**", name: "a", want: true},
+		{pattern: "a/*", name: "a", want: false},
+		{pattern: "*", name: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.name, func(t *testing.T) {
+			var name []string
+			if tt.name != "" {
+				name = strings.Split(tt.name, "/")
+			}
+
+			if got := matchGlob(strings.Split(tt.pattern, "/"), name); got != tt.want {
+				t.Errorf("matchGlob(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpandFile tests expanding local directories and glob patterns into the files of all archives.
+func TestExpandFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := []string{
+		"a.warc.gz",
+		"b.warc",
+		"notes.txt",
+		"crawl/seg1/warc/c.warc.gz",
+		"crawl/seg1/wet/c.warc.wet.gz",
+		"crawl/seg2/warc/d.warc.zst",
+		"crawl/seg2/warc/index.cdx",
+		"crawl/archives.tar",
+		"literal[1]/e.warc",
+	}
+
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+
+		err := os.MkdirAll(filepath.Dir(p), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(p, []byte("WARC/1.0\r\n"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		addr    string   // Address, relative to the directory
+		want    []string // Expanded paths, relative to the directory
+		wantErr bool
+	}{
+		{
+			name: "directory",
+			addr: "crawl",
+			want: []string{"crawl/archives.tar", "crawl/seg1/warc/c.warc.gz", "crawl/seg1/wet/c.warc.wet.gz", "crawl/seg2/warc/d.warc.zst"},
+		},
+		{name: "file", addr: "notes.txt", want: []string{"notes.txt"}},
+		{name: "missing file", addr: "missing.warc", want: []string{"missing.warc"}},
+		{name: "glob", addr: "*.warc*", want: []string{"a.warc.gz", "b.warc"}},
+		{name: "glob matching directories", addr: "crawl/*/wet", want: []string{"crawl/seg1/wet/c.warc.wet.gz"}},
+		{name: "recursive glob", addr: "crawl/**/warc/*", want: []string{"crawl/seg1/warc/c.warc.gz", "crawl/seg2/warc/d.warc.zst", "crawl/seg2/warc/index.cdx"}},
+		{name: "recursive glob of files", addr: "**/*.warc", want: []string{"b.warc", "literal[1]/e.warc"}},
+		{name: "literal path with meta characters", addr: "literal[1]", want: []string{"literal[1]/e.warc"}},
+		{name: "glob matching nothing", addr: "*.arc", wantErr: true},
+		{name: "recursive glob matching nothing", addr: "crawl/**/*.arc", wantErr: true},
+		{name: "invalid glob", addr: "crawl/[a-", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		for _, fileURL := range []bool{false, true} {
+			name := tt.name
+			if fileURL {
+				name += " (file URL)"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				addr := filepath.Join(dir, filepath.FromSlash(tt.addr))
+				if fileURL {
+					addr = "file://" + filepath.ToSlash(addr)
+				}
+
+				got, err := Expand(context.Background(), addr)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Expand() error = %v, want error %t", err, tt.wantErr)
+				}
+
+				if tt.wantErr {
+					if !strings.Contains(err.Error(), tt.addr) {
+						t.Errorf("Expand() error = %v, want it to name the pattern", err)
+					}
+
+					return
+				}
+
+				want := make([]string, len(tt.want))
+				for i, p := range tt.want {
+					want[i] = filepath.Join(dir, filepath.FromSlash(p))
+					if fileURL {
+						want[i] = (&url.URL{Scheme: "file", Path: filepath.ToSlash(want[i])}).String()
+					}
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Expand() = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
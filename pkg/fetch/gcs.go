@@ -0,0 +1,101 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// DefaultGCSEndpoint is the default endpoint of the Google Cloud Storage JSON API.
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+	// gcsEmulatorHostEnv is the environment variable pointing to a storage emulator (like fake-gcs-server), as
+	// used by the official client libraries.
+	gcsEmulatorHostEnv = "STORAGE_EMULATOR_HOST"
+
+	// gcsReadOnlyScope is the OAuth2 scope needed to read objects.
+	gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+	// gcsGenerationHeader is the header containing the generation of an object.
+	gcsGenerationHeader = "X-Goog-Generation"
+
+	// gcsHashHeader is the header containing the hashes of an object.
+	gcsHashHeader = "X-Goog-Hash"
+)
+
+// openGCSURL returns the given Google Cloud Storage URL ("gs://bucket/object"), starting at the given offset and
+// limited to length bytes (unless negative).
+func openGCSURL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	// Determine endpoint and whether to authenticate
+	endpoint, anonymous := params.gcsEndpoint, params.gcsAnonymous
+
+	if endpoint == "" {
+		endpoint = DefaultGCSEndpoint
+
+		if host := os.Getenv(gcsEmulatorHostEnv); host != "" {
+			// Emulators don't need authentication
+			endpoint, anonymous = host, true
+
+			if !strings.Contains(endpoint, "://") {
+				endpoint = "http://" + endpoint
+			}
+		}
+	}
+
+	// Create JSON API media download URL. Only resume with the same generation of the object.
+	target := fmt.Sprintf(
+		"%s/storage/v1/b/%s/o/%s?alt=media",
+		strings.TrimSuffix(endpoint, "/"),
+		url.PathEscape(u.Host),
+		url.PathEscape(strings.TrimPrefix(u.Path, "/")),
+	)
+
+	if (prev != nil) && (prev.version != "") {
+		target += "&ifGenerationMatch=" + url.QueryEscape(prev.version)
+	}
+
+	// Fetch object, authenticating with application default credentials if necessary
+	obj, header, err := openHTTP(ctx, target, params, offset, length, prev, func(req *http.Request) error {
+		if anonymous {
+			return nil
+		}
+
+		ts, err := params.session.gcsTokenSource(ctx)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("find GCS application default credentials (or use anonymous access): %w", err))
+		}
+
+		tok, err := ts.Token()
+		if err != nil {
+			return fmt.Errorf("get GCS access token: %w", err)
+		}
+
+		tok.SetAuthHeader(req)
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("GCS fetch [url=%s]: %w", u.String(), err)
+	}
+
+	obj.version = header.Get(gcsGenerationHeader)
+
+	// MD5 hash of the full object (e.g. "crc32c=n03x6A==,md5=Ojk9c3dhfxgoKVVHYwFbHQ==")
+	for _, h := range header.Values(gcsHashHeader) {
+		for _, kv := range strings.Split(h, ",") {
+			if k, v, _ := strings.Cut(strings.TrimSpace(kv), "="); k == "md5" {
+				if sum := newBase64Checksum("md5", v, "GCS object hash"); sum != nil {
+					obj.checksums = append(obj.checksums, sum)
+				}
+			}
+		}
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,229 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// fakeGCSObject is an object served by fakeGCS.
+type fakeGCSObject struct {
+	content    string
+	generation int64
+	md5        string // Base64 encoded MD5 hash, computed from the content if empty
+}
+
+// fakeGCS emulates the media download of the GCS JSON API, like fake-gcs-server does.
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string]*fakeGCSObject // Objects by "bucket/name"
+	requests []*http.Request
+	truncate bool // Set to abort the next download half way through
+}
+
+// ServeHTTP serves "/storage/v1/b/{bucket}/o/{object}?alt=media".
+func (fg *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fg.mu.Lock()
+	fg.requests = append(fg.requests, r)
+
+	truncate := fg.truncate
+	fg.truncate = false
+
+	// Parse path, the object name is escaped
+	rest, ok := strings.CutPrefix(r.URL.EscapedPath(), "/storage/v1/b/")
+	bucket, name, _ := strings.Cut(rest, "/o/")
+
+	if !ok || (r.URL.Query().Get("alt") != "media") {
+		fg.mu.Unlock()
+		http.Error(w, "not supported", http.StatusBadRequest)
+		return
+	}
+
+	bucket, _ = url.PathUnescape(bucket)
+	name, _ = url.PathUnescape(name)
+
+	obj, ok := fg.objects[bucket+"/"+name]
+	fg.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	// Preconditions
+	if gen := r.URL.Query().Get("ifGenerationMatch"); (gen != "") && (gen != strconv.FormatInt(obj.generation, 10)) {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Metadata
+	sum := obj.md5
+	if sum == "" {
+		h := md5.Sum([]byte(obj.content))
+		sum = base64.StdEncoding.EncodeToString(h[:])
+	}
+
+	w.Header().Set(gcsGenerationHeader, strconv.FormatInt(obj.generation, 10))
+	w.Header().Set(gcsHashHeader, "crc32c=n03x6A==,md5="+sum)
+
+	if truncate {
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.content)))
+		_, _ = io.WriteString(w, obj.content[:len(obj.content)/2])
+
+		panic(http.ErrAbortHandler)
+	}
+
+	http.ServeContent(w, r, name, time.Time{}, strings.NewReader(obj.content))
+}
+
+// newFakeGCS starts a fake GCS server serving the given objects (by "bucket/name").
+func newFakeGCS(t *testing.T, objects map[string]*fakeGCSObject) (*fakeGCS, *httptest.Server) {
+	t.Helper()
+
+	fg := &fakeGCS{objects: objects}
+
+	srv := httptest.NewServer(fg)
+	t.Cleanup(srv.Close)
+
+	return fg, srv
+}
+
+// TestOpenGCS tests fetching objects from a fake GCS server.
+func TestOpenGCS(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("gcs content\n", 1000)
+
+	tests := []struct {
+		name    string
+		object  *fakeGCSObject
+		url     string
+		wantErr bool
+	}{
+		{name: "object", object: &fakeGCSObject{content: content, generation: 1}, url: "gs://bucket/file.warc"},
+		{name: "nested object", object: &fakeGCSObject{content: content, generation: 1}, url: "gs://bucket/crawl/dir/file.warc"},
+		{name: "special characters", object: &fakeGCSObject{content: content, generation: 1}, url: "gs://bucket/a%20b%3Fc.warc"},
+		{name: "missing object", url: "gs://bucket/missing.warc", wantErr: true},
+		{name: "checksum mismatch", object: &fakeGCSObject{content: content, generation: 1, md5: "AAAAAAAAAAAAAAAAAAAAAA=="}, url: "gs://bucket/file.warc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := make(map[string]*fakeGCSObject)
+
+			if tt.object != nil {
+				u, _ := url.Parse(tt.url)
+				objects[u.Host+u.Path] = tt.object
+			}
+
+			_, srv := newFakeGCS(t, objects)
+
+			// Read
+			got, err := readAll(context.Background(), tt.url, WithGCSEndpoint(srv.URL), WithGCSAnonymous(true), WithChecksum(ChecksumAuto))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got != content) {
+				t.Errorf("Open() content = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// TestOpenGCSResume tests resuming interrupted downloads from a fake GCS server, as long as the generation of the
+// object did not change.
+func TestOpenGCSResume(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("gcs content\n", 1000)
+
+	tests := []struct {
+		name    string
+		change  bool // Set to change the generation of the object after the interruption
+		wantErr bool
+	}{
+		{name: "same generation"},
+		{name: "changed generation", change: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &fakeGCSObject{content: content, generation: 1}
+			fg, srv := newFakeGCS(t, map[string]*fakeGCSObject{"bucket/file.warc": obj})
+
+			fg.truncate = true
+
+			// Emulators are picked up from the environment, without authentication
+			t.Setenv(gcsEmulatorHostEnv, strings.TrimPrefix(srv.URL, "http://"))
+
+			r, err := Open(context.Background(), "gs://bucket/file.warc", WithBackoffFunc(func() backoff.BackOff {
+				return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+			}))
+
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			defer r.Close()
+
+			if tt.change {
+				fg.mu.Lock()
+				obj.generation = 2
+				fg.mu.Unlock()
+			}
+
+			got, err := io.ReadAll(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadAll() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (string(got) != content) {
+				t.Errorf("ReadAll() content = %q, want %q", got, content)
+			}
+
+			// The resumed request must be conditional on the generation, and must not be authenticated
+			fg.mu.Lock()
+			defer fg.mu.Unlock()
+
+			last := fg.requests[len(fg.requests)-1]
+
+			if gen := last.URL.Query().Get("ifGenerationMatch"); gen != "1" {
+				t.Errorf("resumed request ifGenerationMatch = %q, want %q", gen, "1")
+			}
+
+			for _, req := range fg.requests {
+				if auth := req.Header.Get("Authorization"); auth != "" {
+					t.Errorf("request to emulator authenticated with %q", auth)
+				}
+			}
+		})
+	}
+}
+
+// readAll opens addr, and returns all of its content.
+func readAll(ctx context.Context, addr string, opts ...Option) (string, error) {
+	r, err := Open(ctx, addr, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	var buf bytes.Buffer
+
+	_, err = io.Copy(&buf, r)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	// DefaultIAEndpoint is the default endpoint of the Internet Archive.
+	DefaultIAEndpoint = "https://archive.org"
+
+	// maxIAMetadataSize is the maximum size of the metadata of Internet Archive items that is read.
+	maxIAMetadataSize = 16 * 1024 * 1024
+)
+
+// iaMetadata is the metadata of an Internet Archive item, as returned by the metadata API.
+type iaMetadata struct {
+	Files []struct {
+		Name string `json:"name"`
+	} `json:"files"`
+}
+
+// iaFiles is the "_files.xml" metadata of an Internet Archive item.
+type iaFiles struct {
+	Files []struct {
+		Name string `xml:"name,attr"`
+		MD5  string `xml:"md5"`
+		SHA1 string `xml:"sha1"`
+	} `xml:"file"`
+}
+
+// iaURL returns the URL of the given path (like "/metadata/item") at the configured Internet Archive endpoint.
+func iaURL(params *params, path string) (*url.URL, error) {
+	endpoint := params.iaEndpoint
+	if endpoint == "" {
+		endpoint = DefaultIAEndpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse Internet Archive endpoint [endpoint=%s]: %w", endpoint, err)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = ""
+
+	return u, nil
+}
+
+// parseIAURL returns the item identifier and file name of an Internet Archive URL, which is either of the form
+// "ia://item/file.warc.gz" or a download URL ("https://archive.org/download/item/file.warc.gz", also at the
+// configured endpoint). The file name may be empty for "ia://" URLs. False is returned for all other URLs.
+func parseIAURL(u *url.URL, params *params) (string, string, bool) {
+	// Item URL
+	if u.Scheme == "ia" {
+		return u.Host, strings.TrimPrefix(u.Path, "/"), u.Host != ""
+	}
+
+	// Download URL
+	du, err := iaURL(params, "/download/")
+	if err != nil {
+		return "", "", false
+	}
+
+	isIAHost := (u.Host == du.Host) || (u.Hostname() == "archive.org") || strings.HasSuffix(u.Hostname(), ".archive.org")
+	if ((u.Scheme != "http") && (u.Scheme != "https")) || !isIAHost {
+		return "", "", false
+	}
+
+	prefix := "/download/"
+	if u.Host == du.Host {
+		prefix = du.Path
+	}
+
+	rest, ok := strings.CutPrefix(u.Path, prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, name, ok := strings.Cut(rest, "/")
+	return id, name, ok && (id != "") && (name != "")
+}
+
+// iaDownloadURL returns the download URL of file name of Internet Archive item id.
+func iaDownloadURL(params *params, id string, name string) (*url.URL, error) {
+	return iaURL(params, "/download/"+id+"/"+name)
+}
+
+// openIAURL opens the file of an Internet Archive item at URL u ("ia://item/file.warc.gz") via its download URL.
+func openIAURL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	id, name, ok := parseIAURL(u, params)
+	if !ok || (name == "") {
+		return nil, errors.New(`Internet Archive URL must be of the form "ia://item/file"`)
+	}
+
+	du, err := iaDownloadURL(params, id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return openHTTPURL(ctx, du, params, offset, length, prev)
+}
+
+// expandIAURL expands URL u ("ia://item" or "ia://item/pattern") into the download URLs of all web archives of
+// the Internet Archive item, as listed by the metadata API. If a glob pattern is given, only files matching it
+// are returned. Without glob pattern, the URL of the given file is returned as it is.
+func expandIAURL(ctx context.Context, u *url.URL, params *params) ([]string, error) {
+	id, pattern, ok := parseIAURL(u, params)
+	if !ok {
+		return nil, errors.New(`Internet Archive URL must be of the form "ia://item" or "ia://item/pattern"`)
+	}
+
+	// Single file
+	if (pattern != "") && !hasGlob(pattern) {
+		du, err := iaDownloadURL(params, id, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{du.String()}, nil
+	}
+
+	if pattern != "" {
+		err := checkGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Read item metadata
+	mu, err := iaURL(params, "/metadata/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readSmallObjectLimit(ctx, mu, params, openHTTPURL, maxIAMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("read item metadata [url=%s]: %w", mu, err)
+	}
+
+	var metadata iaMetadata
+
+	err = json.Unmarshal(content, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("parse item metadata [url=%s]: %w", mu, err)
+	}
+
+	// The metadata API returns an empty object for missing items
+	if len(metadata.Files) == 0 {
+		return nil, fmt.Errorf("Internet Archive item not found [item=%s]", id)
+	}
+
+	// Collect web archives
+	var addrs []string
+
+	for _, f := range metadata.Files {
+		if !isArchiveName(f.Name) {
+			continue
+		}
+
+		if (pattern != "") && !matchGlob(strings.Split(pattern, "/"), strings.Split(f.Name, "/")) {
+			continue
+		}
+
+		du, err := iaDownloadURL(params, id, f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, du.String())
+	}
+
+	slices.Sort(addrs)
+
+	return addrs, nil
+}
+
+// readIAChecksum reads the checksum of the file at URL u (like "https://archive.org/download/item/file.warc.gz")
+// from the "_files.xml" metadata of its Internet Archive item. Nil is returned if u doesn't point to a file of an
+// item, or the item has no checksum for it.
+func readIAChecksum(ctx context.Context, u *url.URL, params *params) (*checksum, error) {
+	// Bail if not an item file
+	id, name, ok := parseIAURL(u, params)
+	if !ok || (name == "") {
+		return nil, nil
+	}
+
+	// Read item metadata
+	mu, err := iaDownloadURL(params, id, id+"_files.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readSmallObjectLimit(ctx, mu, params, openHTTPURL, maxIAMetadataSize)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read item metadata [url=%s]: %w", mu, err)
+	}
+
+	var files iaFiles
+
+	err = xml.Unmarshal(content, &files)
+	if err != nil {
+		return nil, fmt.Errorf("parse item metadata [url=%s]: %w", mu, err)
+	}
+
+	// Find file, preferring SHA-1 over MD5
+	for _, f := range files.Files {
+		if f.Name != name {
+			continue
+		}
+
+		switch {
+		case f.SHA1 != "":
+			return newChecksum("sha1", strings.TrimSpace(f.SHA1), mu.String())
+		case f.MD5 != "":
+			return newChecksum("md5", strings.TrimSpace(f.MD5), mu.String())
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,266 @@
+package fetch
+
+import (
+	"context"
+	"crypto/md5"  //nolint:gosec // Only used to compute checksums as provided by the Internet Archive
+	"crypto/sha1" //nolint:gosec // Only used to compute checksums as provided by the Internet Archive
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// iaStub emulates the metadata API and downloads of the Internet Archive for a single item.
+type iaStub struct {
+	mu       sync.Mutex
+	item     string            // Item identifier
+	files    map[string]string // Content by file name
+	filesXML string            // Content of "_files.xml", or empty if missing
+	requests []string          // Paths of all requests
+}
+
+// ServeHTTP serves "/metadata/{item}" and "/download/{item}/{file}".
+func (is *iaStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	is.mu.Lock()
+	is.requests = append(is.requests, r.URL.Path)
+	is.mu.Unlock()
+
+	// Metadata API, which returns an empty object for missing items
+	if id, ok := strings.CutPrefix(r.URL.Path, "/metadata/"); ok {
+		w.Header().Set("Content-Type", "application/json")
+
+		if id != is.item {
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+
+		var names []string
+		for name := range is.files {
+			names = append(names, `{"name":"`+name+`"}`)
+		}
+
+		_, _ = w.Write([]byte(`{"files":[` + strings.Join(names, ",") + `]}`))
+		return
+	}
+
+	// Downloads
+	rest, ok := strings.CutPrefix(r.URL.Path, "/download/"+is.item+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, ok := is.files[rest]
+	if rest == is.item+"_files.xml" {
+		content, ok = is.filesXML, is.filesXML != ""
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, rest, time.Time{}, strings.NewReader(content))
+}
+
+// newIAStub starts an Internet Archive stub serving the given files of item.
+func newIAStub(t *testing.T, item string, files map[string]string, filesXML string) (*iaStub, *httptest.Server) {
+	t.Helper()
+
+	is := &iaStub{item: item, files: files, filesXML: filesXML}
+
+	srv := httptest.NewServer(is)
+	t.Cleanup(srv.Close)
+
+	return is, srv
+}
+
+// TestExpandIA tests expanding Internet Archive items into the download URLs of their web archives.
+func TestExpandIA(t *testing.T) {
+	files := map[string]string{
+		"b.warc.gz":          "",
+		"a.warc.gz":          "",
+		"dir/c.warc.zst":     "",
+		"d.zip":              "",
+		"item_meta.xml":      "",
+		"item_files.xml":     "",
+		"screenshot.png":     "",
+		"dir/index.cdx.gz":   "",
+		"dir/other.arc.gz":   "",
+		"dir/sub/e.warc.bz2": "",
+	}
+
+	tests := []struct {
+		name         string
+		addr         string
+		want         []string // Download paths
+		wantMetadata bool     // Set if the metadata API must be requested
+		wantErr      bool
+	}{
+		{
+			name: "item",
+			addr: "ia://item",
+			want: []string{
+				"/download/item/a.warc.gz",
+				"/download/item/b.warc.gz",
+				"/download/item/d.zip",
+				"/download/item/dir/c.warc.zst",
+				"/download/item/dir/other.arc.gz",
+				"/download/item/dir/sub/e.warc.bz2",
+			},
+			wantMetadata: true,
+		},
+		{
+			name:         "pattern",
+			addr:         "ia://item/*.warc.gz",
+			want:         []string{"/download/item/a.warc.gz", "/download/item/b.warc.gz"},
+			wantMetadata: true,
+		},
+		{
+			name:         "recursive pattern",
+			addr:         "ia://item/dir/**/*.warc.*",
+			want:         []string{"/download/item/dir/c.warc.zst", "/download/item/dir/sub/e.warc.bz2"},
+			wantMetadata: true,
+		},
+		{
+			name:         "pattern without matches",
+			addr:         "ia://item/*.arc",
+			wantMetadata: true,
+		},
+		{
+			name: "single file",
+			addr: "ia://item/a.warc.gz",
+			want: []string{"/download/item/a.warc.gz"},
+		},
+		{name: "missing item", addr: "ia://missing", wantErr: true},
+		{name: "invalid pattern", addr: "ia://item/[a-", wantErr: true},
+		{name: "missing identifier", addr: "ia:///a.warc.gz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is, srv := newIAStub(t, "item", files, "")
+
+			got, err := Expand(context.Background(), tt.addr, WithIAEndpoint(srv.URL))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var want []string
+			for _, p := range tt.want {
+				want = append(want, srv.URL+p)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expand() = %q, want %q", got, want)
+			}
+
+			is.mu.Lock()
+			defer is.mu.Unlock()
+
+			if metadata := len(is.requests) > 0; metadata != tt.wantMetadata {
+				t.Errorf("Expand() requested %q, want metadata request %t", is.requests, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+// TestOpenIA tests opening files of Internet Archive items, verified against the checksums of the item metadata.
+func TestOpenIA(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("ia content\n", 100)
+
+	sha1Sum := sha1.Sum([]byte(content)) //nolint:gosec // See above
+	md5Sum := md5.Sum([]byte(content))   //nolint:gosec // See above
+
+	// filesXML returns the "_files.xml" metadata with the given checksums of "file.warc.gz"
+	filesXML := func(sums string) string {
+		return `<files>` +
+			`<file name="other.warc.gz" source="original"><sha1>` + strings.Repeat("0", 40) + `</sha1></file>` +
+			`<file name="file.warc.gz" source="original">` + sums + `</file>` +
+			`</files>`
+	}
+
+	tests := []struct {
+		name         string
+		addr         string // Address, with "ENDPOINT" standing in for the URL of the stub
+		filesXML     string
+		wantErr      bool
+		wantMismatch bool // Set if the content must fail verification
+	}{
+		{
+			name:     "SHA-1",
+			addr:     "ia://item/file.warc.gz",
+			filesXML: filesXML("<md5>" + strings.Repeat("0", 32) + "</md5><sha1>" + hex.EncodeToString(sha1Sum[:]) + "</sha1>"),
+		},
+		{
+			name:     "MD5",
+			addr:     "ia://item/file.warc.gz",
+			filesXML: filesXML("<md5>" + hex.EncodeToString(md5Sum[:]) + "</md5>"),
+		},
+		{
+			name:     "download URL",
+			addr:     "ENDPOINT/download/item/file.warc.gz",
+			filesXML: filesXML("<sha1>" + hex.EncodeToString(sha1Sum[:]) + "</sha1>"),
+		},
+		{
+			name:         "checksum mismatch",
+			addr:         "ia://item/file.warc.gz",
+			filesXML:     filesXML("<sha1>" + strings.Repeat("0", 40) + "</sha1>"),
+			wantErr:      true,
+			wantMismatch: true,
+		},
+		{
+			name:     "no checksum",
+			addr:     "ia://item/file.warc.gz",
+			filesXML: filesXML(""),
+			wantErr:  true,
+		},
+		{
+			name:    "missing metadata",
+			addr:    "ia://item/file.warc.gz",
+			wantErr: true,
+		},
+		{
+			name:     "invalid metadata",
+			addr:     "ia://item/file.warc.gz",
+			filesXML: "<files><file",
+			wantErr:  true,
+		},
+		{
+			name:     "missing file",
+			addr:     "ia://item/missing.warc.gz",
+			filesXML: filesXML(""),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newIAStub(t, "item", map[string]string{"file.warc.gz": content}, tt.filesXML)
+
+			addr := strings.ReplaceAll(tt.addr, "ENDPOINT", srv.URL)
+
+			got, err := readAll(context.Background(), addr, WithIAEndpoint(srv.URL), WithChecksum(ChecksumAuto))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got != content) {
+				t.Errorf("Open() content = %q, want %q", got, content)
+			}
+
+			if tt.wantMismatch && !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("Open() error = %v, want %v", err, ErrChecksumMismatch)
+			}
+		})
+	}
+}
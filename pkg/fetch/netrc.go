@@ -0,0 +1,134 @@
+package fetch
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// netrcEntry wraps the credentials for a single machine of a netrc file.
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrc wraps the credentials of a netrc file.
+type netrc struct {
+	machines map[string]netrcEntry // Credentials by host name
+	def      *netrcEntry           // Default credentials, if any
+}
+
+// readNetrc reads the netrc file at the given path (as used by curl and ftp).
+func readNetrc(path string) (*netrc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	// Tokenize, skipping macro definitions (which end with an empty line)
+	var tokens []string
+	var inMacro bool
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if inMacro {
+			inMacro = len(fields) > 0
+			continue
+		}
+
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+
+			if field == "macdef" {
+				inMacro = true
+				tokens = append(tokens, fields[i:min(i+2, len(fields))]...)
+				break
+			}
+
+			tokens = append(tokens, field)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Parse entries
+	n := &netrc{machines: make(map[string]netrcEntry)}
+
+	var machine string
+	var entry *netrcEntry
+
+	flush := func() {
+		if entry == nil {
+			return
+		}
+
+		if machine == "" {
+			n.def = entry
+		} else if _, ok := n.machines[machine]; !ok {
+			// First entry for a machine wins
+			n.machines[machine] = *entry
+		}
+
+		entry = nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		// Get value, if any
+		var value string
+		if i+1 < len(tokens) {
+			value = tokens[i+1]
+		}
+
+		switch tokens[i] {
+		case "machine":
+			flush()
+			machine, entry = value, &netrcEntry{}
+			i++
+
+		case "default":
+			flush()
+			machine, entry = "", &netrcEntry{}
+
+		case "login":
+			if entry != nil {
+				entry.login = value
+			}
+			i++
+
+		case "password":
+			if entry != nil {
+				entry.password = value
+			}
+			i++
+
+		case "account", "macdef":
+			i++
+		}
+	}
+
+	flush()
+
+	return n, nil
+}
+
+// lookup returns the credentials for the given host, falling back to the default credentials.
+func (n *netrc) lookup(host string) (netrcEntry, bool) {
+	if e, ok := n.machines[host]; ok {
+		return e, true
+	}
+
+	if n.def != nil {
+		return *n.def, true
+	}
+
+	return netrcEntry{}, false
+}
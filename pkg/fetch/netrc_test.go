@@ -0,0 +1,135 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReadNetrc tests parsing netrc files, and looking up credentials by host.
+func TestReadNetrc(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		host    string
+		want    netrcEntry
+		wantOk  bool
+	}{
+		{
+			name:    "machine",
+			content: "machine example.com login user password secret\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "user", password: "secret"},
+			wantOk:  true,
+		},
+		{
+			name:    "multiple lines",
+			content: "machine a.example.com\n  login alice\n  password one\n\nmachine b.example.com\n  login bob\n  password two\n",
+			host:    "b.example.com",
+			want:    netrcEntry{login: "bob", password: "two"},
+			wantOk:  true,
+		},
+		{
+			name:    "unknown machine",
+			content: "machine example.com login user password secret\n",
+			host:    "other.com",
+		},
+		{
+			name:    "default",
+			content: "machine example.com login user password secret\ndefault login anonymous password guest\n",
+			host:    "other.com",
+			want:    netrcEntry{login: "anonymous", password: "guest"},
+			wantOk:  true,
+		},
+		{
+			name:    "machine before default",
+			content: "default login anonymous password guest\nmachine example.com login user password secret\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "user", password: "secret"},
+			wantOk:  true,
+		},
+		{
+			name:    "first entry wins",
+			content: "machine example.com login first password one\nmachine example.com login second password two\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "first", password: "one"},
+			wantOk:  true,
+		},
+		{
+			name:    "account",
+			content: "machine example.com login user account acct password secret\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "user", password: "secret"},
+			wantOk:  true,
+		},
+		{
+			name:    "comments",
+			content: "# machine example.com login commented password out\nmachine example.com login user # trailing\npassword secret\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "user", password: "secret"},
+			wantOk:  true,
+		},
+		{
+			name: "macro definition",
+			content: "machine a.example.com login alice password one\n" +
+				"macdef init\nmachine b.example.com login mallory password evil\n\n" +
+				"machine c.example.com login carol password three\n",
+			host: "b.example.com",
+		},
+		{
+			name: "after macro definition",
+			content: "machine a.example.com login alice password one\n" +
+				"macdef init\ncd /pub\n\n" +
+				"machine c.example.com login carol password three\n",
+			host:   "c.example.com",
+			want:   netrcEntry{login: "carol", password: "three"},
+			wantOk: true,
+		},
+		{
+			name:    "login without password",
+			content: "machine example.com login user\n",
+			host:    "example.com",
+			want:    netrcEntry{login: "user"},
+			wantOk:  true,
+		},
+		{
+			name:    "credentials outside of entry",
+			content: "login user password secret\n",
+			host:    "example.com",
+		},
+		{
+			name:    "empty",
+			content: "",
+			host:    "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".netrc")
+
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := readNetrc(path)
+			if err != nil {
+				t.Fatalf("readNetrc() error = %v", err)
+			}
+
+			got, ok := n.lookup(tt.host)
+			if (got != tt.want) || (ok != tt.wantOk) {
+				t.Errorf("lookup(%q) = %+v, %t, want %+v, %t", tt.host, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+// TestReadNetrcMissing tests that reading a missing netrc file fails.
+func TestReadNetrcMissing(t *testing.T) {
+	_, err := readNetrc(filepath.Join(t.TempDir(), ".netrc"))
+	if !os.IsNotExist(err) {
+		t.Errorf("readNetrc() error = %v, want not exist", err)
+	}
+}
@@ -5,43 +5,74 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/cenkalti/backoff/v4"
 )
 
 var (
-	// DefaultTimeout is the default timeout for fetching the URL.
-	DefaultTimeout = 60 * time.Second
+	// DefaultTimeout is the default overall timeout for a single request (zero means no timeout).
+	DefaultTimeout = time.Duration(0)
+
+	// DefaultConnectTimeout is the default timeout for establishing a connection.
+	DefaultConnectTimeout = 30 * time.Second
+
+	// DefaultHeaderTimeout is the default timeout for waiting for the response header.
+	DefaultHeaderTimeout = 60 * time.Second
+
+	// DefaultIdleTimeout is the default timeout after which a transfer is considered stalled.
+	DefaultIdleTimeout = 60 * time.Second
+
+	// DefaultUserAgent is the default User-Agent header of HTTP requests.
+	DefaultUserAgent = "troll-a (+https://github.com/crissyfield/troll-a)"
 
 	// DefaultBackOff is the default backoff strategy for fetching the URL.
 	DefaultBackOff = &backoff.StopBackOff{}
+
+	// MaxRetryAfter is the longest delay requested by a server (via Retry-After) that is honored. Retrying fails
+	// if a server asks for a longer delay.
+	MaxRetryAfter = 15 * time.Minute
 )
 
-// Open will fetch address addr using the given options.
-func Open(addr string, opts ...Option) (io.ReadCloser, error) {
+// Open will fetch address addr using the given options. Failed attempts are retried using the configured backoff
+// strategy, unless the error is permanent (like a missing object or denied access). Reading from the returned
+// reader will transparently resume downloads that got interrupted (for all schemes but files), using the same
+// strategy. If a checksum is configured, the content is verified against it while being read. Canceling the
+// context aborts fetching, including any retries, and reading from the returned reader.
+// Large objects are downloaded using multiple connections, if configured and supported by the server. If a cache
+// is configured, remote objects are served from the cache if possible (validated by requesting the first byte
+// only), and cached while being read otherwise.
+func Open(ctx context.Context, addr string, opts ...Option) (io.ReadCloser, error) {
 	// Bootstrap params
-	params := &params{
-		timeout: DefaultTimeout,
-		backOff: DefaultBackOff,
-	}
-
-	for _, o := range opts {
-		o(params)
+	params, err := newParams(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// Early exit on STDIN
+	// Early exit on STDIN, which can only be verified against an explicit checksum
 	if (addr == "") || (addr == "-") {
-		return io.NopCloser(os.Stdin), nil
+		if params.checksum == "" {
+			return io.NopCloser(os.Stdin), nil
+		}
+
+		if params.checksum == ChecksumAuto {
+			return nil, errors.New("no checksum found for STDIN")
+		}
+
+		sum, err := parseChecksum(params.checksum, "explicit")
+		if err != nil {
+			return nil, err
+		}
+
+		return finishReader(io.NopCloser(os.Stdin), -1, sum), nil
 	}
 
 	// Parse URL
@@ -51,96 +82,387 @@ func Open(addr string, opts ...Option) (io.ReadCloser, error) {
 	}
 
 	// Pick proper fetch strategy
-	var rc io.ReadCloser
-
-	err = backoff.Retry(
-		func() error {
-			switch u.Scheme {
-			case "http", "https":
-				// HTTP/HTTPS
-				return openHTTPURL(u, params, &rc)
-
-			case "s3":
-				// Amazon S3
-				return openS3URL(u, params, &rc)
-
-			case "file", "":
-				// File URL
-				return openFileURL(u, params, &rc)
-
-			default:
-				// Unknown schema
-				return backoff.Permanent(fmt.Errorf("schema not supported"))
-			}
-		},
-		params.backOff,
-	)
+	var open openFunc
+
+	switch u.Scheme {
+	case "http", "https":
+		// HTTP/HTTPS
+		open = openHTTPURL
+
+	case "s3":
+		// Amazon S3
+		open = openS3URL
+
+	case "gs":
+		// Google Cloud Storage
+		open = openGCSURL
+
+	case "az", "abfs", "abfss":
+		// Azure Blob Storage
+		open = openAzureURL
+
+	case "ia":
+		// Internet Archive
+		open = openIAURL
+
+	case "sftp":
+		// SFTP
+		open = openSFTPURL
+
+	case "file", "":
+		// File URL
+		open = openFileURL
+
+	default:
+		// Registered scheme, or unknown schema
+		opener, ok := registeredScheme(u.Scheme)
+		if !ok {
+			return nil, fmt.Errorf("schema not supported")
+		}
+
+		open = newSchemeOpenFunc(opener)
+	}
+
+	// Limit bandwidth of every request, if requested
+	if params.rateLimiter != nil {
+		open = rateLimitedOpenFunc(open, params.rateLimiter)
+	}
+
+	// Use cached copy, if possible, before requesting the content
+	cacheable := (params.cacheDir != "") && (u.Scheme != "file") && (u.Scheme != "")
+
+	if cacheable {
+		if r := openValidatedCache(ctx, u, params, open); r != nil {
+			return r, nil
+		}
+	}
+
+	// Open object
+	var obj *object
+
+	err = retry(ctx, params.newBackOff(), func() error {
+		o, err := open(ctx, u, params, 0, -1, nil)
+		if err != nil {
+			return err
+		}
+
+		obj = o
+		return nil
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return rc, nil
+	// Determine checksum to verify the content against, if requested
+	var sum *checksum
+
+	if params.checksum != "" {
+		sum, err = resolveChecksum(ctx, u, params, open, obj)
+		if err != nil {
+			obj.body.Close()
+			return nil, fmt.Errorf("resolve checksum [url=%s]: %w", redactURL(addr), err)
+		}
+	}
+
+	// Files can be read directly
+	if f, ok := obj.body.(*os.File); ok {
+		return finishReader(f, obj.size, sum), nil
+	}
+
+	// Use cached copy, if possible (like if the server sent a different validator for the first byte only)
+	key, ok := cacheKey(u, obj)
+	cacheable = cacheable && ok
+
+	if cacheable {
+		if f, ok := openCached(params.cacheDir, key); ok {
+			obj.body.Close()
+			return finishReader(f, obj.size, sum), nil
+		}
+	}
+
+	// Download large objects in parallel parts if possible, otherwise resume with a fresh backoff strategy
+	var rr io.ReadCloser
+
+	if (params.connections > 1) && obj.acceptRanges && (obj.size > parallelChunkSize) {
+		rr = newParallelReader(ctx, u, params, open, obj, params.connections)
+	} else {
+		bo := params.newBackOff()
+		bo.Reset()
+
+		rr = &resumeReader{ctx: ctx, u: u, params: params, open: open, obj: obj, body: obj.body, backOff: bo}
+	}
+
+	// Cache while reading, if possible
+	if cacheable {
+		rr = newCachingReader(rr, params.cacheDir, key, params.cacheMaxSize, obj.size)
+	}
+
+	return finishReader(rr, obj.size, sum), nil
 }
 
-// openHTTPURL returns a reader for the given HTTP/HTTPS URL.
-func openHTTPURL(u *url.URL, params *params, rc *io.ReadCloser) error {
-	// HTTP/HTTPS
-	hc := &http.Client{Timeout: params.timeout}
+// finishReader wraps the content reader r of an object of the given size (or -1 if unknown), verifying the
+// content against checksum sum (if not nil). Files that are not verified are returned as they are, to retain
+// random access.
+func finishReader(r io.ReadCloser, size int64, sum *checksum) io.ReadCloser {
+	if sum != nil {
+		r = newVerifyingReader(r, sum)
+	} else if _, ok := r.(*os.File); ok {
+		return r
+	}
+
+	return &sizedReader{ReadCloser: r, size: size}
+}
+
+// sizedReader wraps a content reader, remembering the full size of the content.
+type sizedReader struct {
+	io.ReadCloser
+	size int64 // Full size of the content, or -1 if unknown
+}
+
+// Size returns the full size of the content read by reader r, as returned by Open, or -1 if it is unknown (like
+// for STDIN or servers that don't tell).
+func Size(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *sizedReader:
+		return r.size
+
+	case *os.File:
+		fi, err := r.Stat()
+		if (err != nil) || !fi.Mode().IsRegular() {
+			return -1
+		}
+
+		return fi.Size()
+
+	default:
+		return -1
+	}
+}
+
+// openHTTPURL returns the given HTTP/HTTPS URL, starting at the given offset and limited to length bytes (unless
+// negative).
+func openHTTPURL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	obj, _, err := openHTTP(ctx, u.String(), params, offset, length, prev, func(req *http.Request) error {
+		// Authenticate, unless the URL contains credentials
+		switch {
+		case params.bearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+params.bearerToken)
+
+		case params.basicUser != "":
+			req.SetBasicAuth(params.basicUser, params.basicPass)
+
+		case (u.User == nil) && (params.netrc != nil):
+			if e, ok := params.netrc.lookup(u.Hostname()); ok {
+				req.SetBasicAuth(e.login, e.password)
+			}
+		}
+
+		// Add custom headers
+		for name, values := range params.headers {
+			req.Header[name] = values
+		}
+
+		return nil
+	})
+
+	return obj, err
+}
 
-	res, err := hc.Get(u.String()) //nolint // res.Body will be closed by the decompression wrapper!
+// openHTTP returns the given HTTP/HTTPS target, starting at the given offset and limited to length bytes (unless
+// negative). If not nil, prepare is called to customize the request before it is sent. The response header is
+// returned alongside the object.
+func openHTTP(ctx context.Context, target string, params *params, offset int64, length int64, prev *object, prepare func(*http.Request) error) (*object, http.Header, error) {
+	// Create request, which can be canceled if the transfer stalls
+	ctx, cancel := context.WithCancel(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
-		return fmt.Errorf("HTTP fetch [url=%s]: %w", u.String(), err)
+		cancel()
+		return nil, nil, backoff.Permanent(fmt.Errorf("create HTTP request [url=%s]: %w", redactURL(target), err))
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected HTTP status: %d", res.StatusCode)
+	ranged := (offset > 0) || (length >= 0)
+
+	if ranged {
+		// Request remaining bytes (or the requested part) only, but only if the object did not change in the
+		// meantime. Weak ETags can't be used for this (RFC 9110, section 13.1.5).
+		req.Header.Set("Range", formatRange(offset, length))
+
+		switch {
+		case prev == nil:
+			// Nothing to compare with
+
+		case (prev.etag != "") && !strings.HasPrefix(prev.etag, "W/"):
+			req.Header.Set("If-Range", prev.etag)
+
+		case prev.lastModified != "":
+			req.Header.Set("If-Range", prev.lastModified)
+		}
 	}
 
-	*rc = res.Body
-	return nil
-}
+	if params.userAgent != "" {
+		req.Header.Set("User-Agent", params.userAgent)
+	}
+
+	// Ask for the content as it is stored. Otherwise the transport would transparently decompress gzip encoded
+	// content, and resuming at an offset into the decompressed content would then corrupt it.
+	req.Header.Set("Accept-Encoding", "identity")
 
-// openS3URL returns a reader for the given Amazon S3 URL.
-func openS3URL(u *url.URL, params *params, rc *io.ReadCloser) error {
-	hc := &http.Client{Timeout: params.timeout}
+	if prepare != nil {
+		err = prepare(req)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+	}
 
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+	// HTTP/HTTPS
+	res, err := params.session.httpClient.Do(req) //nolint // res.Body will be closed by the decompression wrapper!
 	if err != nil {
-		return backoff.Permanent(fmt.Errorf("load default AWS config: %w", err))
+		cancel()
+
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = redactURL(ue.URL)
+		}
+
+		return nil, nil, fmt.Errorf("HTTP fetch [url=%s]: %w", redactURL(target), err)
 	}
 
-	s3c := s3.NewFromConfig(cfg)
+	// Check status
+	switch {
+	case !ranged && (res.StatusCode == http.StatusOK):
+		// Full content
+
+	case ranged && (res.StatusCode == http.StatusPartialContent):
+		// Remaining content (or requested part), starting at the correct offset
+		if !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			res.Body.Close()
+			cancel()
+			return nil, nil, backoff.Permanent(fmt.Errorf("unexpected HTTP content range: %s", res.Header.Get("Content-Range")))
+		}
 
-	res, err := s3c.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(u.Host),
-		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
-	})
+	case ranged && (res.StatusCode == http.StatusOK):
+		// Server ignored range, either because the object changed or because ranges are not supported
+		res.Body.Close()
+		cancel()
+		return nil, nil, backoff.Permanent(errors.New("HTTP server can't resume download"))
+
+	default:
+		res.Body.Close()
+		cancel()
+		return nil, nil, newStatusError(res)
+	}
 
+	// Determine full size
+	size := parseContentRangeSize(res.Header.Get("Content-Range"))
+	if (size < 0) && (length < 0) && (res.ContentLength >= 0) {
+		size = offset + res.ContentLength
+	}
+
+	obj := &object{
+		body:         newIdleTimeoutReader(res.Body, params.idleTimeout, cancel),
+		size:         size,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+		acceptRanges: (res.StatusCode == http.StatusPartialContent) || (res.Header.Get("Accept-Ranges") == "bytes"),
+	}
+
+	// Content-MD5 only applies to the full content, as sent by the server
+	if md5 := res.Header.Get("Content-MD5"); (md5 != "") && !ranged && !res.Uncompressed {
+		if sum := newBase64Checksum("md5", md5, "Content-MD5 header"); sum != nil {
+			obj.checksums = append(obj.checksums, sum)
+		}
+	}
+
+	return obj, res.Header, nil
+}
+
+// formatRange returns the value of a Range header requesting length bytes starting at the given offset, or all
+// remaining bytes if length is negative.
+func formatRange(offset int64, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// parseContentRangeSize returns the full size of an object given in the value of a Content-Range header (like
+// "bytes 0-499/1234"), or -1 if it is missing or unknown.
+func parseContentRangeSize(value string) int64 {
+	_, rawSize, ok := strings.Cut(value, "/")
+	if !ok {
+		return -1
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(rawSize), 10, 64)
 	if err != nil {
-		return fmt.Errorf("S3 fetch [url=%s]: %w", u.String(), err)
+		return -1
 	}
 
-	*rc = res.Body
-	return nil
+	return size
 }
 
-// openFileURL returns a reader for the given file URL.
-func openFileURL(u *url.URL, _ *params, rc *io.ReadCloser) error {
+// redactURL returns the given URL with credentials (like a password, the signature of an Azure SAS token, or the
+// signature of a presigned URL) masked, so it can be safely logged.
+func redactURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+
+	query := u.Query()
+
+	for k := range query {
+		switch strings.ToLower(k) {
+		case "sig", "signature", "x-amz-signature", "x-goog-signature":
+			query.Set(k, "REDACTED")
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u.Redacted()
+}
+
+// openFileURL returns the given file URL, starting at the given offset.
+func openFileURL(_ context.Context, u *url.URL, _ *params, offset int64, _ int64, _ *object) (*object, error) {
 	// Get path from URL
 	path, err := pathFromURL(u)
 	if err != nil {
-		return fmt.Errorf("file fetch [url=%s]: %w", u.String(), err)
+		return nil, fmt.Errorf("file fetch [url=%s]: %w", u.String(), err)
 	}
 
-	// Open file
+	// Open file, missing files or permissions won't change on retry
 	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("file open [url=%s]: %w", u.String(), err)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			return nil, backoff.Permanent(fmt.Errorf("file open [url=%s]: %w", u.String(), err))
+		}
+
+		return nil, fmt.Errorf("file open [url=%s]: %w", u.String(), err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("file stat [url=%s]: %w", u.String(), err)
+	}
+
+	if offset > 0 {
+		_, err = f.Seek(offset, io.SeekStart)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("file seek [url=%s]: %w", u.String(), err)
+		}
 	}
 
-	*rc = f
-	return nil
+	return &object{
+		body:         f,
+		size:         fi.Size(),
+		lastModified: fi.ModTime().UTC().Format(http.TimeFormat),
+	}, nil
 }
 
 // Get the file path from the URL.
@@ -0,0 +1,254 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// TestOpenHTTPContentEncoding tests that content sent with "Content-Encoding: gzip" is fetched as it is stored,
+// so interrupted downloads are resumed at the correct offset.
+func TestOpenHTTPContentEncoding(t *testing.T) {
+	// Random content barely compresses, so the interrupted response contains part of it
+	content := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(content)
+	zw.Close()
+
+	encoded := buf.Bytes()
+
+	var mu sync.Mutex
+	var encodings []string
+	var ranges []string
+
+	// Server sending a (misconfigured) content encoding for a compressed file, interrupting the first response
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(encodings) == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("ETag", `"v1"`)
+
+		if first {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(encoded)))
+			_, _ = w.Write(encoded[:len(encoded)/2])
+
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(encoded))
+	}))
+
+	defer srv.Close()
+
+	got, err := readAll(context.Background(), srv.URL+"/file.warc.gz", WithBackoffFunc(func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+	}))
+
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if got != string(encoded) {
+		t.Errorf("Open() content differs from the %d bytes of the encoded content [len=%d]", len(encoded), len(got))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if (len(ranges) != 2) || (ranges[1] != "bytes="+strconv.Itoa(len(encoded)/2)+"-") {
+		t.Errorf("request ranges = %q, want the download to be resumed half way through", ranges)
+	}
+
+	for _, enc := range encodings {
+		if enc != "identity" {
+			t.Errorf("request Accept-Encoding = %q, want %q", enc, "identity")
+		}
+	}
+}
+
+// TestOpenHTTPStalled tests that a response stalling part way through the body is detected by the idle timeout,
+// and the download is resumed at the offset reached.
+func TestOpenHTTPStalled(t *testing.T) {
+	content := bytes.Repeat([]byte("WARC/1.0\r\nWARC-Type: response\r\n"), 2048)
+
+	tests := []struct {
+		name        string
+		retries     uint64
+		wantRanges  []string
+		wantStalled bool // Set if reading must fail with ErrStalled
+	}{
+		{
+			name:       "resumed",
+			retries:    3,
+			wantRanges: []string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"},
+		},
+		{
+			name:        "not retried",
+			retries:     0,
+			wantRanges:  []string{""},
+			wantStalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var ranges []string
+
+			canceled := make(chan struct{})
+
+			// Server stalling after half of the first response, until the client gives up on it
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				first := len(ranges) == 1
+				mu.Unlock()
+
+				w.Header().Set("ETag", `"v1"`)
+
+				if !first {
+					http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+					return
+				}
+
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				_, _ = w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+
+				select {
+				case <-r.Context().Done():
+					close(canceled)
+				case <-time.After(5 * time.Second):
+				}
+
+				panic(http.ErrAbortHandler)
+			}))
+
+			defer srv.Close()
+
+			got, err := readAll(context.Background(), srv.URL+"/file.warc",
+				WithIdleTimeout(100*time.Millisecond),
+				WithBackoffFunc(func() backoff.BackOff {
+					return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, tt.retries)
+				}),
+			)
+
+			switch {
+			case tt.wantStalled && !errors.Is(err, ErrStalled):
+				t.Fatalf("Open() error = %v, want %v", err, ErrStalled)
+			case !tt.wantStalled && (err != nil):
+				t.Fatalf("Open() error = %v", err)
+			case !tt.wantStalled && (got != string(content)):
+				t.Errorf("Open() content differs from the %d bytes of the content [len=%d]", len(content), len(got))
+			}
+
+			// The stalled request was canceled by the client
+			select {
+			case <-canceled:
+			case <-time.After(5 * time.Second):
+				t.Errorf("stalled request was not canceled")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !reflect.DeepEqual(ranges, tt.wantRanges) {
+				t.Errorf("request ranges = %q, want %q", ranges, tt.wantRanges)
+			}
+		})
+	}
+}
+
+// TestIdleTimeoutReader tests that reads are canceled once no data was received within the idle timeout.
+func TestIdleTimeoutReader(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		delay       time.Duration // Delay of each write to the body
+		wantStalled bool
+	}{
+		{name: "fast", timeout: 200 * time.Millisecond, delay: 0},
+		{name: "slow but within timeout", timeout: 200 * time.Millisecond, delay: 20 * time.Millisecond},
+		{name: "stalled", timeout: 20 * time.Millisecond, delay: time.Second, wantStalled: true},
+		{name: "no timeout", timeout: 0, delay: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+
+			// Writer sending three chunks, which is stopped once the reader is canceled
+			done := make(chan struct{})
+
+			go func() {
+				defer pw.Close()
+
+				for range 3 {
+					select {
+					case <-time.After(tt.delay):
+					case <-done:
+						return
+					}
+
+					if _, err := pw.Write([]byte("chunk")); err != nil {
+						return
+					}
+				}
+			}()
+
+			var cancels atomic.Int32
+
+			ir := newIdleTimeoutReader(pr, tt.timeout, func() {
+				if cancels.Add(1) == 1 {
+					close(done)
+					pr.CloseWithError(context.Canceled)
+				}
+			})
+
+			got, err := io.ReadAll(ir)
+
+			switch {
+			case tt.wantStalled && !errors.Is(err, ErrStalled):
+				t.Fatalf("Read() error = %v, want %v", err, ErrStalled)
+			case !tt.wantStalled && (err != nil):
+				t.Fatalf("Read() error = %v", err)
+			case !tt.wantStalled && (string(got) != "chunkchunkchunk"):
+				t.Errorf("Read() = %q, want %q", got, "chunkchunkchunk")
+			}
+
+			// Subsequent reads fail, too
+			if _, err := ir.Read(make([]byte, 1)); tt.wantStalled && !errors.Is(err, ErrStalled) {
+				t.Errorf("Read() after stall error = %v, want %v", err, ErrStalled)
+			}
+
+			ir.Close()
+
+			if cancels.Load() == 0 {
+				t.Errorf("Close() did not cancel the request")
+			}
+		})
+	}
+}
@@ -1,30 +1,396 @@
 package fetch
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/crypto/ssh"
 )
 
 // params wraps all fetching parameters.
 type params struct {
-	timeout time.Duration
-	backOff backoff.BackOff
+	timeout        time.Duration
+	connectTimeout time.Duration
+	headerTimeout  time.Duration
+	idleTimeout    time.Duration
+	newBackOff     func() backoff.BackOff
+
+	userAgent   string
+	headers     http.Header
+	basicUser   string
+	basicPass   string
+	bearerToken string
+	proxy       string
+	proxyURL    *url.URL
+	caBundle    string
+	clientCert  string
+	clientKey   string
+	tlsConfig   *tls.Config
+	netrcFile   string
+	netrc       *netrc
+
+	cacheDir     string
+	cacheMaxSize int64
+	rateLimiter  *RateLimiter
+	connections  int
+	checksum     string
+
+	s3Endpoint      string
+	s3Region        string
+	s3Profile       string
+	s3RoleARN       string
+	s3Anonymous     bool
+	s3RequesterPays bool
+	s3Client        *s3.Client
+
+	gcsEndpoint  string
+	gcsAnonymous bool
+
+	azureEndpoint         string
+	azureAccount          string
+	azureConnectionString string
+	azureSASToken         string
+
+	iaEndpoint string
+	ccEndpoint string
+
+	sshKeyFile        string
+	sshKnownHostsFile string
+	sshSigners        []ssh.Signer
+
+	session *session
 }
 
 // Option is an option for opening a URL.
 type Option func(*params)
 
-// WithTimeout will set the timeout duration for the fetch operation.
+// newParams returns the default parameters, modified by the given options.
+func newParams(opts []Option) (*params, error) {
+	params := &params{
+		timeout:        DefaultTimeout,
+		connectTimeout: DefaultConnectTimeout,
+		headerTimeout:  DefaultHeaderTimeout,
+		idleTimeout:    DefaultIdleTimeout,
+		newBackOff:     func() backoff.BackOff { return DefaultBackOff },
+		userAgent:      DefaultUserAgent,
+		headers:        make(http.Header),
+	}
+
+	for _, o := range opts {
+		o(params)
+	}
+
+	// Checksum
+	if (params.checksum != "") && (params.checksum != ChecksumAuto) {
+		_, err := parseChecksum(params.checksum, "explicit")
+		if err != nil {
+			return nil, fmt.Errorf("parse checksum: %w", err)
+		}
+	}
+
+	// Everything loaded is shared by all fetch operations using the same parameters
+	s, err := getSession(params)
+	if err != nil {
+		return nil, err
+	}
+
+	params.session = s
+	params.proxyURL = s.proxyURL
+	params.tlsConfig = s.tlsConfig
+	params.netrc = s.netrc
+	params.sshSigners = s.sshSigners
+
+	return params, nil
+}
+
+// WithTimeout will set the overall timeout duration for a single request of the fetch operation, including
+// reading the content. A timeout of zero means no timeout. Use WithIdleTimeout to detect stalled transfers
+// instead.
 func WithTimeout(timeout time.Duration) Option {
 	return func(s *params) {
 		s.timeout = timeout
 	}
 }
 
-// WithBackoff will set the backoff strategy for the fetch operation.
+// WithConnectTimeout will set the timeout duration for establishing a connection (including the TLS
+// handshake).
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(s *params) {
+		s.connectTimeout = timeout
+	}
+}
+
+// WithHeaderTimeout will set the timeout duration for waiting for the response header after the request was
+// sent.
+func WithHeaderTimeout(timeout time.Duration) Option {
+	return func(s *params) {
+		s.headerTimeout = timeout
+	}
+}
+
+// WithIdleTimeout will set the timeout duration after which a transfer is considered stalled if no data was
+// received. Stalled transfers are resumed according to the backoff strategy. A timeout of zero means no
+// timeout.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *params) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithBackoff will set the backoff strategy for the fetch operation. As backoff strategies are stateful, the
+// same strategy must not be used for concurrent fetch operations; use WithBackoffFunc instead. Limit the number
+// of retries using WithMaxRetries, so delays requested by servers keep within the maximum elapsed time.
 func WithBackoff(backOff backoff.BackOff) Option {
 	return func(s *params) {
-		s.backOff = backOff
+		s.newBackOff = func() backoff.BackOff { return backOff }
+	}
+}
+
+// WithBackoffFunc will set a function creating a new instance of the backoff strategy for the fetch operation.
+func WithBackoffFunc(fn func() backoff.BackOff) Option {
+	return func(s *params) {
+		s.newBackOff = fn
+	}
+}
+
+// WithUserAgent will set the User-Agent header of HTTP requests.
+func WithUserAgent(userAgent string) Option {
+	return func(s *params) {
+		s.userAgent = userAgent
+	}
+}
+
+// WithHeader will add a custom header to requests of HTTP/HTTPS URLs. Custom headers take precedence over
+// headers set otherwise (e.g. for authentication).
+func WithHeader(name string, value string) Option {
+	return func(s *params) {
+		s.headers.Add(name, value)
+	}
+}
+
+// WithBasicAuth will set the user name and password used to authenticate requests of HTTP/HTTPS URLs.
+func WithBasicAuth(user string, password string) Option {
+	return func(s *params) {
+		s.basicUser = user
+		s.basicPass = password
+	}
+}
+
+// WithBearerToken will set the bearer token used to authenticate requests of HTTP/HTTPS URLs. It takes
+// precedence over basic authentication.
+func WithBearerToken(token string) Option {
+	return func(s *params) {
+		s.bearerToken = token
+	}
+}
+
+// WithNetrc will set the path of a netrc file, which provides credentials for requests of HTTP/HTTPS URLs that
+// are not authenticated otherwise.
+func WithNetrc(file string) Option {
+	return func(s *params) {
+		s.netrcFile = file
+	}
+}
+
+// WithProxy will set the URL of the proxy used for all requests. If not set, the proxy is taken from the
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+func WithProxy(proxyURL string) Option {
+	return func(s *params) {
+		s.proxy = proxyURL
+	}
+}
+
+// WithCABundle will set the path of a PEM file with additional CA certificates to trust, besides the system
+// certificates.
+func WithCABundle(file string) Option {
+	return func(s *params) {
+		s.caBundle = file
+	}
+}
+
+// WithClientCertificate will set the paths of the PEM files of the client certificate and its key, used for
+// mutual TLS. If keyFile is empty, the key is read from certFile as well.
+func WithClientCertificate(certFile string, keyFile string) Option {
+	return func(s *params) {
+		s.clientCert = certFile
+		s.clientKey = keyFile
+	}
+}
+
+// WithChecksum will verify the content of each object against the given checksum while it is read, failing at
+// the end of the content if it does not match (see ErrChecksumMismatch). The checksum is either given explicitly
+// as "algorithm:hex digest" (with algorithm being one of "sha512", "sha256", "sha1", or "md5"), or is
+// ChecksumAuto to take it from wherever it is available: checksums provided by the server (like Amazon S3
+// checksums or Content-MD5 headers), sidecar files (like "example.warc.gz.sha256"), or the "_files.xml"
+// metadata of Internet Archive items. Objects without a checksum fail to open.
+func WithChecksum(checksum string) Option {
+	return func(s *params) {
+		s.checksum = checksum
+	}
+}
+
+// WithConnections will download large remote objects using n concurrent range requests, if the server supports
+// them. The parts are reassembled in order, using up to 16 MiB of memory per connection.
+func WithConnections(n int) Option {
+	return func(s *params) {
+		s.connections = n
+	}
+}
+
+// WithRateLimiter will limit the bandwidth of fetching remote objects using the given rate limiter, which may be
+// shared by concurrent transfers to limit their combined bandwidth. Nil means no limit.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(s *params) {
+		s.rateLimiter = limiter
+	}
+}
+
+// WithCache will enable an on-disk cache of fetched objects in directory dir, which is created if necessary.
+// Only objects with a validator (like an ETag or a last modification date) are cached, and cached copies are
+// only used if the validator did not change. The least recently used objects are evicted to keep the cache
+// below maxSize bytes, unless maxSize is zero. Partially written files left over by crashed runs are removed after
+// a day. Local files and STDIN are never cached.
+func WithCache(dir string, maxSize int64) Option {
+	return func(s *params) {
+		s.cacheDir = dir
+		s.cacheMaxSize = maxSize
+	}
+}
+
+// WithS3Endpoint will set a custom Amazon S3 endpoint (e.g. "http://localhost:9000" for MinIO or Ceph). Custom
+// endpoints are accessed using path-style addressing. This can be overridden by the "endpoint" query parameter
+// of the URL.
+func WithS3Endpoint(endpoint string) Option {
+	return func(s *params) {
+		s.s3Endpoint = endpoint
+	}
+}
+
+// WithS3Region will set the Amazon S3 region. If not set, the region of the default AWS configuration is used,
+// or DefaultS3Region if there is none. This can be overridden by the "region" query parameter of the URL.
+func WithS3Region(region string) Option {
+	return func(s *params) {
+		s.s3Region = region
+	}
+}
+
+// WithS3Profile will set the profile of the shared AWS configuration to use. This can be overridden by the
+// "profile" query parameter of the URL.
+func WithS3Profile(profile string) Option {
+	return func(s *params) {
+		s.s3Profile = profile
+	}
+}
+
+// WithS3RoleARN will set the ARN of an IAM role to assume for accessing Amazon S3. This can be overridden by
+// the "role-arn" query parameter of the URL.
+func WithS3RoleARN(arn string) Option {
+	return func(s *params) {
+		s.s3RoleARN = arn
+	}
+}
+
+// WithS3Anonymous will set whether Amazon S3 is accessed with unsigned requests (e.g. for public buckets like
+// "commoncrawl"). This can be overridden by the "anonymous" query parameter of the URL.
+func WithS3Anonymous(anonymous bool) Option {
+	return func(s *params) {
+		s.s3Anonymous = anonymous
+	}
+}
+
+// WithS3RequesterPays will set whether the requester agrees to pay for accessing requester-pays buckets. This
+// can be overridden by the "requester-pays" query parameter of the URL.
+func WithS3RequesterPays(requesterPays bool) Option {
+	return func(s *params) {
+		s.s3RequesterPays = requesterPays
+	}
+}
+
+// WithGCSEndpoint will set the endpoint of the Google Cloud Storage JSON API (e.g. to use a local emulator like
+// fake-gcs-server). If not set, the STORAGE_EMULATOR_HOST environment variable is honored, and
+// DefaultGCSEndpoint is used otherwise.
+func WithGCSEndpoint(endpoint string) Option {
+	return func(s *params) {
+		s.gcsEndpoint = endpoint
+	}
+}
+
+// WithGCSAnonymous will set whether Google Cloud Storage is accessed anonymously (e.g. for public buckets),
+// instead of using application default credentials.
+func WithGCSAnonymous(anonymous bool) Option {
+	return func(s *params) {
+		s.gcsAnonymous = anonymous
+	}
+}
+
+// WithAzureEndpoint will set the Azure Blob Storage service endpoint, including the account name for path-style
+// endpoints (e.g. "http://127.0.0.1:10000/devstoreaccount1" for a local Azurite). If not set, the endpoint is
+// taken from the connection string, or derived from the account name.
+func WithAzureEndpoint(endpoint string) Option {
+	return func(s *params) {
+		s.azureEndpoint = endpoint
+	}
+}
+
+// WithAzureAccount will set the Azure Storage account name. If not set, the account name is taken from the
+// connection string or the AZURE_STORAGE_ACCOUNT environment variable.
+func WithAzureAccount(account string) Option {
+	return func(s *params) {
+		s.azureAccount = account
+	}
+}
+
+// WithAzureConnectionString will set the Azure Storage connection string, providing the endpoint and
+// credentials. If not set, the AZURE_STORAGE_CONNECTION_STRING environment variable is honored.
+func WithAzureConnectionString(cs string) Option {
+	return func(s *params) {
+		s.azureConnectionString = cs
+	}
+}
+
+// WithAzureSASToken will set the shared access signature (SAS) token used to access Azure Blob Storage. If not
+// set, a SAS token from the connection string or the AZURE_STORAGE_SAS_TOKEN environment variable is used.
+// Without any SAS token or account key, Azure Blob Storage is accessed anonymously.
+func WithAzureSASToken(token string) Option {
+	return func(s *params) {
+		s.azureSASToken = token
+	}
+}
+
+// WithIAEndpoint will set the endpoint of the Internet Archive (e.g. to use a local mirror or stub), used for
+// "ia://" URLs and item metadata. Defaults to DefaultIAEndpoint.
+func WithIAEndpoint(endpoint string) Option {
+	return func(s *params) {
+		s.iaEndpoint = endpoint
+	}
+}
+
+// WithCCEndpoint will set the endpoint of Common Crawl used for "cc://" URLs, which is prepended to the paths of
+// the manifest and all archives (e.g. "s3://commoncrawl", or a local directory mirroring the crawl data).
+// Defaults to DefaultCCEndpoint.
+func WithCCEndpoint(endpoint string) Option {
+	return func(s *params) {
+		s.ccEndpoint = endpoint
+	}
+}
+
+// WithSSHKeyFile will set the (unencrypted) private key file used to authenticate "sftp://" connections. Without
+// key file, the default keys ("~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", and "~/.ssh/id_rsa") are tried.
+func WithSSHKeyFile(file string) Option {
+	return func(s *params) {
+		s.sshKeyFile = file
+	}
+}
+
+// WithSSHKnownHostsFile will set the known hosts file the host keys of "sftp://" servers are checked against.
+// Defaults to "~/.ssh/known_hosts". Connections to unknown hosts are refused.
+func WithSSHKnownHostsFile(file string) Option {
+	return func(s *params) {
+		s.sshKnownHostsFile = file
 	}
 }
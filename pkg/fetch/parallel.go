@@ -0,0 +1,260 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+)
+
+const (
+	// parallelChunkSize is the size of the parts requested by parallel downloads.
+	parallelChunkSize = 8 * 1024 * 1024
+)
+
+// chunk wraps a downloaded part of an object.
+type chunk struct {
+	buf  []byte // Buffer holding the part, to be reused for later parts
+	data []byte // Remaining unread data of the part
+	err  error  // Error if downloading the part failed
+}
+
+// chunkJob describes a part of an object to be downloaded by a worker.
+type chunkJob struct {
+	offset int64         // Offset of the part within the object
+	data   []byte        // Buffer to read the part into
+	body   io.ReadCloser // Content to continue with first, if not nil
+	result chan *chunk   // Channel receiving the downloaded part
+}
+
+// parallelReader reads an object using multiple concurrent range requests, reassembling the parts in order. Each
+// of the workers has at most one request in flight, so the number of connections is capped, and connections are
+// reused for later parts. At most twice as many parts as connections are kept in memory, so a slow reader
+// throttles the downloads.
+type parallelReader struct {
+	ctx     context.Context    // Canceled when the reader got closed
+	cancel  context.CancelFunc // Cancels all downloads
+	wg      sync.WaitGroup     // Waits for the dispatcher and all workers
+	chunks  chan chan *chunk   // Parts being downloaded, in order
+	free    chan []byte        // Buffers available for parts (nil if not yet allocated)
+	current *chunk             // Part currently being read
+	err     error              // Sticky error
+}
+
+// newParallelReader returns a reader for object obj at URL u, downloading it in parts using the given number of
+// concurrent connections until the context is canceled. The content of obj is used for the first part.
+func newParallelReader(ctx context.Context, u *url.URL, params *params, open openFunc, obj *object, connections int) *parallelReader {
+	window := 2 * connections
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	pr := &parallelReader{
+		ctx:    ctx,
+		cancel: cancel,
+		chunks: make(chan chan *chunk, window),
+		free:   make(chan []byte, window),
+	}
+
+	for i := 0; i < window; i++ {
+		pr.free <- nil
+	}
+
+	// Start workers, fed by the dispatcher
+	jobs := make(chan *chunkJob)
+
+	pr.wg.Add(connections + 1)
+
+	for i := 0; i < connections; i++ {
+		go func() {
+			defer pr.wg.Done()
+
+			for job := range jobs {
+				err := pr.download(u, params, open, obj, job.offset, job.data, job.body)
+				job.result <- &chunk{buf: job.data[:cap(job.data)], data: job.data, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer pr.wg.Done()
+		defer close(jobs)
+
+		pr.dispatch(jobs, obj.size, &onceCloser{ReadCloser: obj.body})
+	}()
+
+	return pr
+}
+
+// dispatch hands the parts of an object of the given size to the workers in order, as long as buffers are
+// available. The first part continues with the initially opened content.
+func (pr *parallelReader) dispatch(jobs chan<- *chunkJob, size int64, initial io.ReadCloser) {
+	defer close(pr.chunks)
+
+	defer func() {
+		if initial != nil {
+			initial.Close()
+		}
+	}()
+
+	for offset := int64(0); offset < size; offset += parallelChunkSize {
+		// Wait for a free buffer
+		var buf []byte
+
+		select {
+		case buf = <-pr.free:
+		case <-pr.ctx.Done():
+			return
+		}
+
+		if buf == nil {
+			buf = make([]byte, parallelChunkSize)
+		}
+
+		// Queue part
+		job := &chunkJob{
+			offset: offset,
+			data:   buf[:min(parallelChunkSize, size-offset)],
+			body:   initial,
+			result: make(chan *chunk, 1),
+		}
+
+		select {
+		case pr.chunks <- job.result:
+		case <-pr.ctx.Done():
+			return
+		}
+
+		select {
+		case jobs <- job:
+			initial = nil
+		case <-pr.ctx.Done():
+			// The part was queued already, so the reader must not wait for it
+			job.result <- &chunk{buf: buf, err: pr.ctx.Err()}
+			return
+		}
+	}
+}
+
+// download reads the part of object obj starting at the given offset into data, continuing with body (if not
+// nil) first. Failed attempts are resumed using the configured backoff strategy.
+func (pr *parallelReader) download(u *url.URL, params *params, open openFunc, obj *object, offset int64, data []byte, body io.ReadCloser) error {
+	read := 0
+
+	// The initial content was opened before, so it must be aborted explicitly once the reader got closed
+	if body != nil {
+		initial := body
+		stop := context.AfterFunc(pr.ctx, func() { initial.Close() })
+
+		defer stop()
+	}
+
+	err := retry(pr.ctx, params.newBackOff(), func() error {
+		// Request (remaining) part
+		if body == nil {
+			o, err := open(pr.ctx, u, params, offset+int64(read), int64(len(data)-read), obj)
+			if err != nil {
+				return err
+			}
+
+			err = checkResumedObject(obj, o)
+			if err != nil {
+				o.body.Close()
+				return err
+			}
+
+			body = o.body
+		}
+
+		// Read part, keeping what was read if it fails
+		n, err := io.ReadFull(body, data[read:])
+		read += n
+
+		body.Close()
+		body = nil
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return err
+	})
+
+	if body != nil {
+		body.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("read [offset=%d]: %w", offset+int64(read), err)
+	}
+
+	return nil
+}
+
+// Read reads up to len(p) bytes into p.
+func (pr *parallelReader) Read(p []byte) (int, error) {
+	if pr.err != nil {
+		return 0, pr.err
+	}
+
+	// Move on to next part, if necessary
+	for (pr.current == nil) || (len(pr.current.data) == 0) {
+		if pr.current != nil {
+			pr.free <- pr.current.buf
+			pr.current = nil
+		}
+
+		ch, ok := <-pr.chunks
+		if !ok {
+			// Dispatching stops early if the context got canceled
+			pr.err = io.EOF
+			if err := pr.ctx.Err(); err != nil {
+				pr.err = err
+			}
+
+			return 0, pr.err
+		}
+
+		var c *chunk
+
+		select {
+		case c = <-ch:
+		case <-pr.ctx.Done():
+			c = &chunk{err: pr.ctx.Err()}
+		}
+
+		if c.err != nil {
+			pr.err = c.err
+			return 0, pr.err
+		}
+
+		pr.current = c
+	}
+
+	n := copy(p, pr.current.data)
+	pr.current.data = pr.current.data[n:]
+
+	return n, nil
+}
+
+// Close stops all downloads, and waits for them to finish.
+func (pr *parallelReader) Close() error {
+	pr.cancel()
+	pr.wg.Wait()
+
+	return nil
+}
+
+// onceCloser wraps a content reader that may be closed concurrently (like the initial content of a parallel
+// download), closing it only once.
+type onceCloser struct {
+	io.ReadCloser
+	once sync.Once
+	err  error
+}
+
+// Close closes the content reader, unless it was closed before.
+func (oc *onceCloser) Close() error {
+	oc.once.Do(func() { oc.err = oc.ReadCloser.Close() })
+	return oc.err
+}
@@ -0,0 +1,222 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// memoryObject serves an object from memory, keeping track of the content readers.
+type memoryObject struct {
+	data    []byte
+	open    atomic.Int32 // Number of content readers currently open
+	maxOpen atomic.Int32 // Maximum number of content readers open at the same time
+	read    atomic.Int64 // Number of bytes read from all content readers
+}
+
+// memoryBody is a content reader of a memoryObject.
+type memoryBody struct {
+	r      *bytes.Reader
+	obj    *memoryObject
+	closed bool
+}
+
+// Read reads up to len(p) bytes into p.
+func (mb *memoryBody) Read(p []byte) (int, error) {
+	n, err := mb.r.Read(p)
+	mb.obj.read.Add(int64(n))
+
+	return n, err
+}
+
+// Close closes the content reader.
+func (mb *memoryBody) Close() error {
+	if !mb.closed {
+		mb.closed = true
+		mb.obj.open.Add(-1)
+	}
+
+	return nil
+}
+
+// openFunc opens the object, like the openFunc of a remote scheme.
+func (mo *memoryObject) openFunc(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	end := int64(len(mo.data))
+	if length >= 0 {
+		end = min(offset+length, end)
+	}
+
+	n := mo.open.Add(1)
+
+	for m := mo.maxOpen.Load(); (n > m) && !mo.maxOpen.CompareAndSwap(m, n); m = mo.maxOpen.Load() {
+	}
+
+	return &object{
+		body:         &memoryBody{r: bytes.NewReader(mo.data[offset:end]), obj: mo},
+		size:         int64(len(mo.data)),
+		acceptRanges: true,
+	}, nil
+}
+
+// newMemoryObject returns an object of the given size with random content.
+func newMemoryObject(size int) *memoryObject {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	return &memoryObject{data: data}
+}
+
+// openParallel opens the object mo using a parallel reader with the given number of connections.
+func openParallel(t *testing.T, ctx context.Context, mo *memoryObject, open openFunc, connections int) *parallelReader {
+	t.Helper()
+
+	params := &params{newBackOff: func() backoff.BackOff { return &backoff.StopBackOff{} }}
+	u := &url.URL{Scheme: "memory", Path: "/object"}
+
+	obj, err := open(ctx, u, params, 0, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newParallelReader(ctx, u, params, open, obj, connections)
+}
+
+// TestParallelReader tests that parallel downloads are reassembled in order, using at most the given number of
+// connections.
+func TestParallelReader(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		connections int
+	}{
+		{name: "two connections", size: 5*parallelChunkSize/2 + 17, connections: 2},
+		{name: "more connections than parts", size: parallelChunkSize + 1, connections: 8},
+		{name: "exact parts", size: 3 * parallelChunkSize, connections: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mo := newMemoryObject(tt.size)
+			pr := openParallel(t, context.Background(), mo, mo.openFunc, tt.connections)
+
+			got, err := io.ReadAll(pr)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+
+			pr.Close()
+
+			if !bytes.Equal(got, mo.data) {
+				t.Errorf("ReadAll() returned wrong content [len=%d, want=%d]", len(got), len(mo.data))
+			}
+
+			if n := mo.maxOpen.Load(); n > int32(tt.connections) {
+				t.Errorf("parallel reader used %d connections, want at most %d", n, tt.connections)
+			}
+
+			if n := mo.open.Load(); n != 0 {
+				t.Errorf("parallel reader left %d connections open", n)
+			}
+		})
+	}
+}
+
+// TestParallelReaderRateLimit tests that parallel downloads keep to the rate limit, and that closing the reader
+// stops all downloads.
+func TestParallelReaderRateLimit(t *testing.T) {
+	const rateLimit = 1024 * 1024
+
+	mo := newMemoryObject(4 * parallelChunkSize)
+	open := rateLimitedOpenFunc(mo.openFunc, NewRateLimiter(rateLimit))
+
+	pr := openParallel(t, context.Background(), mo, open, 3)
+
+	// Without reading, downloads proceed according to the rate limit only (each connection may read one burst
+	// ahead of the limiter)
+	time.Sleep(300 * time.Millisecond)
+
+	if n := mo.read.Load(); n > 5*rateLimit {
+		t.Errorf("parallel reader downloaded %d bytes, want at most %d", n, 5*rateLimit)
+	}
+
+	// Closing waits for all downloads to stop
+	pr.Close()
+
+	if n := mo.open.Load(); n != 0 {
+		t.Errorf("Close() left %d connections open", n)
+	}
+
+	read := mo.read.Load()
+	time.Sleep(100 * time.Millisecond)
+
+	if n := mo.read.Load(); n != read {
+		t.Errorf("parallel reader downloaded %d bytes after Close()", n-read)
+	}
+}
+
+// stalledBody is a content reader that ignores cancellation, and only serves its content once released.
+type stalledBody struct {
+	io.ReadCloser
+	release <-chan struct{}
+}
+
+// Read waits for the release, then reads up to len(p) bytes into p.
+func (sb *stalledBody) Read(p []byte) (int, error) {
+	<-sb.release
+	return sb.ReadCloser.Read(p)
+}
+
+// TestParallelReaderCancel tests that reading stops once the context is canceled while all workers are busy,
+// even if parts still being downloaded complete afterwards.
+func TestParallelReaderCancel(t *testing.T) {
+	mo := newMemoryObject(3 * parallelChunkSize)
+	release := make(chan struct{})
+
+	// All parts but the first are stalled until released
+	open := func(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+		obj, err := mo.openFunc(ctx, u, params, offset, length, prev)
+		if (err == nil) && (offset > 0) {
+			obj.body = &stalledBody{ReadCloser: obj.body, release: release}
+		}
+
+		return obj, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pr := openParallel(t, ctx, mo, open, 1)
+	defer pr.Close()
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := io.ReadAll(pr)
+		done <- err
+	}()
+
+	// Wait for the single worker to get stuck on the second part, with the third part queued behind it
+	time.Sleep(200 * time.Millisecond)
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadAll() error = %v, want %v", err, context.Canceled)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadAll() did not return after the context got canceled")
+	}
+}
@@ -0,0 +1,82 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minRateLimitBurst is the minimum number of bytes a rate limiter allows at once, so that reads are not split
+	// into tiny chunks for low rates.
+	minRateLimitBurst = 64 * 1024
+)
+
+// RateLimiter limits the bandwidth of fetching, using a token bucket. A single rate limiter can be shared by any
+// number of concurrent transfers, limiting their combined bandwidth. It is safe for concurrent use.
+type RateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewRateLimiter creates a new rate limiter that allows bytesPerSecond bytes per second. The bucket holds one
+// second worth of bytes (but at least 64 KiB), so short bursts are smoothed out.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	burst := int(max(min(bytesPerSecond, 1<<30), minRateLimitBurst))
+
+	return &RateLimiter{limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst)}
+}
+
+// rateLimitedOpenFunc wraps open, limiting the bandwidth of the content of all opened objects (but files) using
+// limiter. As every response is limited on its own (rather than the reassembled content), parallel downloads are
+// limited as well.
+func rateLimitedOpenFunc(open openFunc, limiter *RateLimiter) openFunc {
+	return func(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+		obj, err := open(ctx, u, params, offset, length, prev)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := obj.body.(*os.File); !ok {
+			ctx, cancel := context.WithCancel(ctx)
+			obj.body = &rateLimitedReader{ctx: ctx, cancel: cancel, body: obj.body, limiter: limiter}
+		}
+
+		return obj, nil
+	}
+}
+
+// rateLimitedReader wraps a content reader, limiting its bandwidth using a rate limiter.
+type rateLimitedReader struct {
+	ctx     context.Context
+	cancel  context.CancelFunc // Stops waiting for the rate limiter
+	body    io.ReadCloser
+	limiter *RateLimiter
+}
+
+// Read reads up to len(p) bytes into p, blocking as long as necessary to keep to the rate limit.
+func (rr *rateLimitedReader) Read(p []byte) (int, error) {
+	// Never read more than the bucket holds
+	if burst := rr.limiter.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := rr.body.Read(p)
+
+	if n > 0 {
+		werr := rr.limiter.limiter.WaitN(rr.ctx, n)
+		if (werr != nil) && (err == nil) {
+			err = werr
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the content reader, aborting a concurrent read waiting for the rate limiter.
+func (rr *rateLimitedReader) Close() error {
+	rr.cancel()
+	return rr.body.Close()
+}
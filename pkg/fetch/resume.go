@@ -0,0 +1,141 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// object wraps an opened object.
+type object struct {
+	body         io.ReadCloser // Content of the object, starting at the requested offset
+	size         int64         // Full size of the object, or -1 if unknown
+	etag         string        // ETag of the object, if known
+	lastModified string        // Last modification date of the object (HTTP date format), if known
+	version      string        // Version of the object (like the GCS generation), if known
+	acceptRanges bool          // Set if parts of the object can be requested (for parallel downloads)
+	checksums    []*checksum   // Checksums of the full object provided by the server, strongest first
+}
+
+// openFunc opens the object at URL u, starting at the given offset. Only length bytes are requested, unless
+// length is negative (files ignore the length, as they are read directly). When resuming or requesting parts of
+// the object, prev describes the object as it was opened initially and should be used to make sure it did not
+// change in the meantime.
+type openFunc func(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error)
+
+// resumeReader reads an object, transparently reopening it at the current offset if reading fails.
+type resumeReader struct {
+	ctx      context.Context
+	u        *url.URL
+	params   *params
+	open     openFunc
+	obj      *object         // The object as it was opened initially
+	body     io.ReadCloser   // The current content reader
+	offset   int64           // Current offset within the object
+	progress bool            // Set if bytes were read since the last resume
+	backOff  backoff.BackOff // Backoff strategy used between attempts to resume
+}
+
+// Read reads up to len(p) bytes into p.
+func (rr *resumeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := rr.body.Read(p)
+
+		rr.offset += int64(n)
+		rr.progress = rr.progress || (n > 0)
+
+		// Premature end of content is treated as a failure
+		if (err == io.EOF) && (rr.obj.size >= 0) && (rr.offset < rr.obj.size) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if (err == nil) || (err == io.EOF) {
+			return n, err
+		}
+
+		// Resume at current offset
+		rerr := rr.resume(err)
+		if rerr != nil {
+			return n, rerr
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close closes the current content reader.
+func (rr *resumeReader) Close() error {
+	return rr.body.Close()
+}
+
+// resume reopens the object at the current offset after reading failed with the given cause, waiting according
+// to the backoff strategy between attempts.
+func (rr *resumeReader) resume(cause error) error {
+	rr.body.Close()
+
+	// Only start over with the backoff strategy if any progress was made
+	if rr.progress {
+		rr.backOff.Reset()
+		rr.progress = false
+	}
+
+	for {
+		// Wait, or give up
+		delay, err := nextDelay(rr.backOff, cause)
+		if err != nil {
+			return fmt.Errorf("read [offset=%d]: %w", rr.offset, err)
+		}
+
+		err = sleep(rr.ctx, delay)
+		if err != nil {
+			return fmt.Errorf("resume [offset=%d]: %w", rr.offset, err)
+		}
+
+		// Reopen object
+		obj, err := rr.open(rr.ctx, rr.u, rr.params, rr.offset, -1, rr.obj)
+		if err == nil {
+			err = checkResumedObject(rr.obj, obj)
+			if err == nil {
+				rr.body = obj.body
+				return nil
+			}
+
+			obj.body.Close()
+		}
+
+		// Give up on permanent errors
+		var perr *backoff.PermanentError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("resume [offset=%d]: %w", rr.offset, unwrapPermanent(err))
+		}
+
+		cause = err
+	}
+}
+
+// checkResumedObject checks that the resumed object obj is consistent with the initially opened object prev.
+func checkResumedObject(prev *object, obj *object) error {
+	if (prev.etag != "") && (obj.etag != "") && (prev.etag != obj.etag) {
+		return backoff.Permanent(fmt.Errorf("object changed [etag=%s, previous=%s]", obj.etag, prev.etag))
+	}
+
+	if (prev.lastModified != "") && (obj.lastModified != "") && (prev.lastModified != obj.lastModified) {
+		return backoff.Permanent(fmt.Errorf("object changed [last-modified=%s, previous=%s]", obj.lastModified, prev.lastModified))
+	}
+
+	if (prev.version != "") && (obj.version != "") && (prev.version != obj.version) {
+		return backoff.Permanent(fmt.Errorf("object changed [version=%s, previous=%s]", obj.version, prev.version))
+	}
+
+	if (prev.size >= 0) && (obj.size >= 0) && (prev.size != obj.size) {
+		return backoff.Permanent(fmt.Errorf("object changed [size=%d, previous=%d]", obj.size, prev.size))
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// slowDownDelay is the minimum delay after Amazon S3 asked to reduce the request rate without specifying
+	// a delay.
+	slowDownDelay = 5 * time.Second
+)
+
+// StatusError is returned if a server responded with an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int           // HTTP status code
+	RetryAfter time.Duration // Delay requested by the server via Retry-After, if any
+}
+
+// Error returns the error message.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status: %d", e.StatusCode)
+}
+
+// newStatusError returns an error for the unexpected HTTP response res. Statuses that are not worth a retry
+// (like 403 or 404) result in a permanent error.
+func newStatusError(res *http.Response) error {
+	err := &StatusError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+	}
+
+	if !isRetryableStatus(res.StatusCode) {
+		return backoff.Permanent(err)
+	}
+
+	return err
+}
+
+// classifyS3Error turns the Amazon S3 error err into a permanent error, if it is not worth a retry.
+func classifyS3Error(err error) error {
+	var re *smithyhttp.ResponseError
+	if errors.As(err, &re) && !isRetryableStatus(re.HTTPStatusCode()) {
+		return backoff.Permanent(err)
+	}
+
+	return err
+}
+
+// isRetryableStatus returns true if a request that failed with the given HTTP status might succeed later on,
+// i.e. on request timeouts, throttling, and server errors.
+func isRetryableStatus(code int) bool {
+	return (code == http.StatusRequestTimeout) || (code == http.StatusTooManyRequests) || (code >= 500)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a delay in seconds or an HTTP
+// date (RFC 9110, section 10.2.3). Zero is returned if the value is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+
+	return 0
+}
+
+// retryAfter returns the delay requested by the server that caused err, if any.
+func retryAfter(err error) time.Duration {
+	// HTTP
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+
+	// Amazon S3
+	var delay time.Duration
+
+	var re *smithyhttp.ResponseError
+	if errors.As(err, &re) && (re.Response != nil) {
+		delay = parseRetryAfter(re.Response.Header.Get("Retry-After"))
+	}
+
+	var ae smithy.APIError
+	if errors.As(err, &ae) && (ae.ErrorCode() == "SlowDown") {
+		delay = max(delay, slowDownDelay)
+	}
+
+	return delay
+}
+
+// retry calls op until it succeeds, fails with a permanent error, the backoff strategy bo gives up, or the
+// context is canceled. Delays requested by the server are honored if they are longer than the delay of the
+// backoff strategy, unless they exceed MaxRetryAfter or the remaining elapsed time of the strategy.
+func retry(ctx context.Context, bo backoff.BackOff, op func() error) error {
+	bo.Reset()
+
+	for {
+		err := op()
+		if err == nil {
+			return nil
+		}
+
+		delay, err := nextDelay(bo, err)
+		if err != nil {
+			return err
+		}
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for the given delay, or returns early with an error if the context is canceled.
+func sleep(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextDelay returns the delay before retrying after op failed with err, or the error to fail with if there
+// should be no retry.
+func nextDelay(bo backoff.BackOff, err error) (time.Duration, error) {
+	// Never retry on permanent errors
+	var perr *backoff.PermanentError
+	if errors.As(err, &perr) {
+		return 0, unwrapPermanent(err)
+	}
+
+	// Ask backoff strategy
+	next := bo.NextBackOff()
+	if next == backoff.Stop {
+		return 0, unwrapPermanent(err)
+	}
+
+	// Honor delay requested by the server, within limits
+	ra := retryAfter(err)
+	if ra <= next {
+		return next, nil
+	}
+
+	if ra > MaxRetryAfter {
+		return 0, fmt.Errorf("retry delay requested by server too long [retry-after=%s, max=%s]: %w", ra, MaxRetryAfter, err)
+	}
+
+	if ebo, ok := unwrapBackOff(bo).(*backoff.ExponentialBackOff); ok && (ebo.MaxElapsedTime > 0) {
+		if remaining := ebo.MaxElapsedTime - ebo.GetElapsedTime(); ra > remaining {
+			return 0, fmt.Errorf("retry delay requested by server exceeds retry budget [retry-after=%s, remaining=%s]: %w", ra, max(remaining, 0), err)
+		}
+	}
+
+	return ra, nil
+}
+
+// maxRetriesBackOff wraps a backoff strategy, giving up after a maximum number of retries.
+type maxRetriesBackOff struct {
+	delegate backoff.BackOff
+	max      uint64
+	tries    uint64
+}
+
+// WithMaxRetries wraps backoff strategy bo, giving up after max retries. Unlike backoff.WithMaxRetries, the wrapped
+// strategy stays accessible, so delays requested by servers are still kept within the maximum elapsed time of an
+// exponential strategy.
+func WithMaxRetries(bo backoff.BackOff, max uint64) backoff.BackOff {
+	return &maxRetriesBackOff{delegate: bo, max: max}
+}
+
+// NextBackOff returns the delay before the next retry, or backoff.Stop if the maximum number of retries is
+// reached.
+func (b *maxRetriesBackOff) NextBackOff() time.Duration {
+	if b.tries >= b.max {
+		return backoff.Stop
+	}
+
+	b.tries++
+
+	return b.delegate.NextBackOff()
+}
+
+// Reset resets the number of retries and the wrapped strategy.
+func (b *maxRetriesBackOff) Reset() {
+	b.tries = 0
+	b.delegate.Reset()
+}
+
+// Unwrap returns the wrapped strategy.
+func (b *maxRetriesBackOff) Unwrap() backoff.BackOff {
+	return b.delegate
+}
+
+// unwrapBackOff returns the innermost backoff strategy wrapped by bo (via "Unwrap() backoff.BackOff"), or bo
+// itself.
+func unwrapBackOff(bo backoff.BackOff) backoff.BackOff {
+	for {
+		u, ok := bo.(interface{ Unwrap() backoff.BackOff })
+		if !ok {
+			return bo
+		}
+
+		bo = u.Unwrap()
+	}
+}
+
+// unwrapPermanent returns the error wrapped by err if it is a permanent error, or err itself. Permanent errors
+// that are wrapped by err are kept, to not lose the context added by wrapping.
+func unwrapPermanent(err error) error {
+	var perr *backoff.PermanentError
+	if errors.As(err, &perr) && (error(perr) == err) {
+		return perr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,152 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "0", want: 0},
+		{value: "120", want: 2 * time.Minute},
+		{value: " 5 ", want: 5 * time.Second},
+		{value: "-1", want: 0},
+		{value: "soon", want: 0},
+		{value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	// HTTP dates in the future
+	got := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if (got < 58*time.Minute) || (got > time.Hour) {
+		t.Errorf("parseRetryAfter(now + 1h) = %s, want about 1h", got)
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	constant := func() backoff.BackOff { return backoff.NewConstantBackOff(time.Second) }
+
+	exponential := func(maxElapsed time.Duration) func() backoff.BackOff {
+		return func() backoff.BackOff {
+			ebo := backoff.NewExponentialBackOff()
+			ebo.InitialInterval = time.Second
+			ebo.RandomizationFactor = 0
+			ebo.MaxElapsedTime = maxElapsed
+			ebo.Reset()
+
+			return ebo
+		}
+	}
+
+	tests := []struct {
+		name       string
+		backOff    func() backoff.BackOff
+		err        error
+		wantDelay  time.Duration
+		wantFailed bool
+	}{
+		{
+			name:      "backoff strategy",
+			backOff:   constant,
+			err:       errors.New("failed"),
+			wantDelay: time.Second,
+		},
+		{
+			name:       "stop",
+			backOff:    func() backoff.BackOff { return &backoff.StopBackOff{} },
+			err:        errors.New("failed"),
+			wantFailed: true,
+		},
+		{
+			name:       "permanent",
+			backOff:    constant,
+			err:        backoff.Permanent(errors.New("failed")),
+			wantFailed: true,
+		},
+		{
+			name:      "shorter retry-after",
+			backOff:   constant,
+			err:       &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Millisecond},
+			wantDelay: time.Second,
+		},
+		{
+			name:      "longer retry-after",
+			backOff:   constant,
+			err:       &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute},
+			wantDelay: time.Minute,
+		},
+		{
+			name:       "retry-after beyond maximum",
+			backOff:    constant,
+			err:        &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: MaxRetryAfter + time.Second},
+			wantFailed: true,
+		},
+		{
+			name:      "retry-after within elapsed budget",
+			backOff:   exponential(time.Hour),
+			err:       &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute},
+			wantDelay: 10 * time.Minute,
+		},
+		{
+			name:       "retry-after beyond elapsed budget",
+			backOff:    exponential(5 * time.Minute),
+			err:        &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute},
+			wantFailed: true,
+		},
+		{
+			name:      "retry-after within elapsed budget of limited retries",
+			backOff:   func() backoff.BackOff { return WithMaxRetries(exponential(time.Hour)(), 3) },
+			err:       &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute},
+			wantDelay: 10 * time.Minute,
+		},
+		{
+			name:       "retry-after beyond elapsed budget of limited retries",
+			backOff:    func() backoff.BackOff { return WithMaxRetries(exponential(5*time.Minute)(), 3) },
+			err:        &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute},
+			wantFailed: true,
+		},
+		{
+			name:       "limited retries exhausted",
+			backOff:    func() backoff.BackOff { return WithMaxRetries(constant(), 0) },
+			err:        errors.New("failed"),
+			wantFailed: true,
+		},
+		{
+			name:      "retry-after without elapsed budget",
+			backOff:   exponential(0),
+			err:       &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute},
+			wantDelay: 10 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bo := tt.backOff()
+			bo.Reset()
+
+			delay, err := nextDelay(bo, tt.err)
+
+			switch {
+			case tt.wantFailed && (err == nil):
+				t.Fatalf("nextDelay() = %s, want error", delay)
+			case !tt.wantFailed && (err != nil):
+				t.Fatalf("nextDelay() failed: %v", err)
+			case !tt.wantFailed && (delay != tt.wantDelay):
+				t.Fatalf("nextDelay() = %s, want %s", delay, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// DefaultS3Region is the region used if no region is configured at all.
+	DefaultS3Region = "us-east-1"
+)
+
+// openS3URL returns the given Amazon S3 URL ("s3://bucket/key"), starting at the given offset and limited to
+// length bytes (unless negative). The URL query may override the S3 options (e.g. "s3://bucket/key?region=us-east-1&anonymous=true").
+func openS3URL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	// Look up client once, it is reused when retrying or resuming
+	if params.s3Client == nil {
+		err := applyS3Query(u.Query(), params)
+		if err != nil {
+			return nil, backoff.Permanent(fmt.Errorf("S3 fetch [url=%s]: %w", u.String(), err))
+		}
+
+		params.s3Client, err = params.session.s3Client(ctx, params)
+		if err != nil {
+			return nil, backoff.Permanent(fmt.Errorf("S3 fetch [url=%s]: %w", u.String(), err))
+		}
+	}
+
+	// Request remaining bytes (or the requested part) only, but only if the object did not change in the meantime
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	}
+
+	if params.s3RequesterPays {
+		input.RequestPayer = types.RequestPayerRequester
+	}
+
+	if params.checksum == ChecksumAuto {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+
+	if (offset > 0) || (length >= 0) {
+		input.Range = aws.String(formatRange(offset, length))
+	}
+
+	if (prev != nil) && (prev.etag != "") {
+		input.IfMatch = aws.String(prev.etag)
+	}
+
+	// Fetch object, which can be canceled if the transfer stalls
+	ctx, cancel := context.WithCancel(ctx)
+
+	res, err := params.s3Client.GetObject(ctx, input)
+	if err != nil {
+		cancel()
+
+		var ae smithy.APIError
+		if errors.As(err, &ae) && (ae.ErrorCode() == "PreconditionFailed") {
+			return nil, backoff.Permanent(fmt.Errorf("S3 object changed [url=%s]: %w", u.String(), err))
+		}
+
+		return nil, classifyS3Error(fmt.Errorf("S3 fetch [url=%s]: %w", u.String(), err))
+	}
+
+	// Determine full size
+	size := parseContentRangeSize(aws.ToString(res.ContentRange))
+	if (size < 0) && (length < 0) && (res.ContentLength != nil) {
+		size = offset + *res.ContentLength
+	}
+
+	var lastModified string
+	if res.LastModified != nil {
+		lastModified = res.LastModified.UTC().Format(http.TimeFormat)
+	}
+
+	obj := &object{
+		body:         newIdleTimeoutReader(res.Body, params.idleTimeout, cancel),
+		size:         size,
+		etag:         aws.ToString(res.ETag),
+		lastModified: lastModified,
+		acceptRanges: true,
+	}
+
+	// Checksums of the full object, if it was uploaded with them (checksums of multipart uploads, like
+	// "abc...=-3", are checksums of the part checksums and can't be verified)
+	if sha256 := aws.ToString(res.ChecksumSHA256); !strings.Contains(sha256, "-") {
+		if sum := newBase64Checksum("sha256", sha256, "S3 checksum"); sum != nil {
+			obj.checksums = append(obj.checksums, sum)
+		}
+	}
+
+	if sha1 := aws.ToString(res.ChecksumSHA1); !strings.Contains(sha1, "-") {
+		if sum := newBase64Checksum("sha1", sha1, "S3 checksum"); sum != nil {
+			obj.checksums = append(obj.checksums, sum)
+		}
+	}
+
+	// The ETag of objects uploaded in a single part is their MD5 digest (unless encrypted with SSE-KMS or SSE-C)
+	if etag := strings.Trim(obj.etag, `"`); (len(etag) == 32) && (res.SSEKMSKeyId == nil) && (res.SSECustomerAlgorithm == nil) {
+		if sum, err := newChecksum("md5", etag, "S3 ETag"); err == nil {
+			obj.checksums = append(obj.checksums, sum)
+		}
+	}
+
+	return obj, nil
+}
+
+// newS3Client creates an Amazon S3 client according to the given parameters, based on the default AWS
+// configuration (environment variables and shared configuration files).
+func newS3Client(ctx context.Context, params *params) (*s3.Client, error) {
+	// Load default configuration. The HTTP client must remain buildable, so the SDK can apply settings like a
+	// custom CA bundle (AWS_CA_BUNDLE).
+	hc := awshttp.NewBuildableClient().
+		WithTransportOptions(func(tr *http.Transport) { configureTransport(tr, params) }).
+		WithTimeout(params.timeout)
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithHTTPClient(hc),
+	}
+
+	if params.s3Region != "" {
+		opts = append(opts, config.WithRegion(params.s3Region))
+	}
+
+	if params.s3Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(params.s3Profile))
+	}
+
+	if params.s3Anonymous {
+		opts = append(opts, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load default AWS config: %w", err)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = DefaultS3Region
+	}
+
+	// Assume role, if requested
+	if params.s3RoleARN != "" {
+		if params.s3Anonymous {
+			return nil, errors.New("can't assume role with anonymous access")
+		}
+
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), params.s3RoleARN))
+	}
+
+	// Create client, using path-style addressing for custom endpoints (like MinIO or Ceph)
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if params.s3Endpoint != "" {
+			o.BaseEndpoint = aws.String(params.s3Endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// applyS3Query overrides the S3 parameters with the given URL query parameters.
+func applyS3Query(query url.Values, params *params) error {
+	for k, v := range query {
+		value := v[len(v)-1]
+
+		switch k {
+		case "endpoint":
+			params.s3Endpoint = value
+
+		case "region":
+			params.s3Region = value
+
+		case "profile":
+			params.s3Profile = value
+
+		case "role-arn":
+			params.s3RoleARN = value
+
+		case "anonymous", "requester-pays":
+			// Flags without value are set
+			b := true
+
+			if value != "" {
+				var err error
+
+				b, err = strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("parse query parameter %s: %w", k, err)
+				}
+			}
+
+			if k == "anonymous" {
+				params.s3Anonymous = b
+			} else {
+				params.s3RequesterPays = b
+			}
+
+		default:
+			return fmt.Errorf(`unknown query parameter, must be one of endpoint, region, profile, role-arn, anonymous, requester-pays (a "?" wildcard must be escaped as "%%3F") [parameter=%s]`, k)
+		}
+	}
+
+	return nil
+}
+
+// expandS3URL expands the given Amazon S3 URL into the URLs of all archives below its prefix (if it ends with a
+// slash) or all objects matching its glob pattern (if any). The URL query is retained for all expanded URLs. As
+// "?" starts the URL query, the "?" wildcard must be escaped ("s3://bucket/a%3F.warc.gz").
+func expandS3URL(ctx context.Context, u *url.URL, params *params) ([]string, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+
+	// Check query first, as a "?" wildcard would have started it (and truncated the pattern)
+	err := applyS3Query(u.Query(), params)
+	if err != nil {
+		return nil, fmt.Errorf("S3 list [url=%s]: %w", u.String(), err)
+	}
+
+	// Bail if neither prefix nor glob pattern
+	isPrefix := (key == "") || strings.HasSuffix(key, "/")
+	isGlob := hasGlob(key)
+
+	if !isPrefix && !isGlob {
+		return []string{u.String()}, nil
+	}
+
+	if isGlob {
+		if err := checkGlob(key); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create client
+	params.s3Client, err = params.session.s3Client(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("S3 list [url=%s]: %w", u.String(), err)
+	}
+
+	// List matching keys
+	var keys []string
+
+	if isGlob {
+		keys, err = globS3Keys(ctx, params, u.Host, "", strings.Split(key, "/"))
+	} else {
+		keys, err = listS3Keys(ctx, params, u.Host, key, false, func(key string) bool { return isArchiveName(key) })
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("S3 list [url=%s]: %w", u.String(), err)
+	}
+
+	// Convert to URLs
+	urls := make([]string, len(keys))
+
+	for i, k := range keys {
+		urls[i] = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + k, RawQuery: u.RawQuery}).String()
+	}
+
+	return urls, nil
+}
+
+// globS3Keys returns all keys below prefix in the given bucket that match the glob pattern, given as segments.
+// Segments are listed one by one, so only the relevant parts of the bucket are listed.
+func globS3Keys(ctx context.Context, params *params, bucket string, prefix string, pattern []string) ([]string, error) {
+	// Skip literal segments
+	i := 0
+	for (i < len(pattern)) && !hasGlob(pattern[i]) {
+		i++
+	}
+
+	if i == len(pattern) {
+		return []string{prefix + strings.Join(pattern, "/")}, nil
+	}
+
+	if i > 0 {
+		prefix += strings.Join(pattern[:i], "/") + "/"
+		pattern = pattern[i:]
+	}
+
+	// Match remaining pattern against all keys below prefix, if it may span multiple segments
+	if strings.Contains(strings.Join(pattern, "/"), "**") {
+		return listS3Keys(ctx, params, bucket, prefix, false, func(key string) bool {
+			return matchGlob(pattern, strings.Split(strings.TrimPrefix(key, prefix), "/"))
+		})
+	}
+
+	// Match last segment against objects
+	if len(pattern) == 1 {
+		return listS3Keys(ctx, params, bucket, prefix, true, func(key string) bool {
+			ok, _ := path.Match(pattern[0], strings.TrimPrefix(key, prefix))
+			return ok
+		})
+	}
+
+	// Match segment against common prefixes, and descend into them
+	dirs, err := listS3Keys(ctx, params, bucket, prefix, true, func(key string) bool {
+		ok, _ := path.Match(pattern[0], strings.TrimSuffix(strings.TrimPrefix(key, prefix), "/"))
+		return ok && strings.HasSuffix(key, "/")
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	for _, d := range dirs {
+		ks, err := globS3Keys(ctx, params, bucket, d, pattern[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, ks...)
+	}
+
+	return keys, nil
+}
+
+// listS3Keys returns all keys below prefix in the given bucket that are accepted by fn. If delimited is set,
+// only keys on the level of the prefix are listed, with deeper levels returned as common prefixes (ending with
+// a slash).
+func listS3Keys(ctx context.Context, params *params, bucket string, prefix string, delimited bool, fn func(key string) bool) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	if delimited {
+		input.Delimiter = aws.String("/")
+	}
+
+	if params.s3RequesterPays {
+		input.RequestPayer = types.RequestPayerRequester
+	}
+
+	var keys []string
+
+	for pg := s3.NewListObjectsV2Paginator(params.s3Client, input); pg.HasMorePages(); {
+		// List next page
+		var page *s3.ListObjectsV2Output
+
+		err := retry(ctx, params.newBackOff(), func() error {
+			p, err := pg.NextPage(ctx)
+			if err != nil {
+				return classifyS3Error(err)
+			}
+
+			page = p
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Collect accepted keys
+		for _, cp := range page.CommonPrefixes {
+			if k := aws.ToString(cp.Prefix); fn(k) {
+				keys = append(keys, k)
+			}
+		}
+
+		for _, o := range page.Contents {
+			if k := aws.ToString(o.Key); !strings.HasSuffix(k, "/") && fn(k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,18 @@
+package fetch
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExpandS3URLWithUnescapedWildcard(t *testing.T) {
+	_, err := Expand(context.Background(), "s3://bucket/a?.warc.gz")
+	if err == nil {
+		t.Fatal("Expand() succeeded, want error")
+	}
+
+	if !strings.Contains(err.Error(), "%3F") {
+		t.Errorf("Expand() error %q does not hint at escaping the wildcard", err)
+	}
+}
@@ -0,0 +1,168 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Object is an object opened by an Opener.
+type Object struct {
+	Body         io.ReadCloser // Content of the object, starting at the requested offset
+	Size         int64         // Full size of the object, or -1 if unknown
+	ETag         string        // ETag of the object, if known
+	LastModified string        // Last modification date of the object (HTTP date format), if known
+	Version      string        // Version of the object, if known
+	AcceptRanges bool          // Set if parts of the object can be requested (for parallel downloads)
+}
+
+// Opener opens objects of a custom URL scheme, registered via RegisterScheme.
+type Opener interface {
+	// Open opens the object at URL u, starting at the given offset. Only length bytes need to be returned, unless
+	// length is negative. When resuming or requesting parts of the object, prev describes the object as it was
+	// opened initially (otherwise it is nil), and should be used to make sure it did not change in the meantime.
+	// If the object can't be opened at a non-zero offset, an error should be returned.
+	Open(ctx context.Context, u *url.URL, offset int64, length int64, prev *Object) (*Object, error)
+}
+
+// OpenerFunc is an adapter to use an ordinary function as Opener.
+type OpenerFunc func(ctx context.Context, u *url.URL, offset int64, length int64, prev *Object) (*Object, error)
+
+// Open calls f(ctx, u, offset, length, prev).
+func (f OpenerFunc) Open(ctx context.Context, u *url.URL, offset int64, length int64, prev *Object) (*Object, error) {
+	return f(ctx, u, offset, length, prev)
+}
+
+// Expander can optionally be implemented by an Opener to expand addresses of its scheme (like prefixes) into
+// the addresses of all archives they refer to, as done by Expand.
+type Expander interface {
+	// Expand expands URL u into the list of addresses of all archives it refers to.
+	Expand(ctx context.Context, u *url.URL) ([]string, error)
+}
+
+var (
+	// schemesMu guards schemes.
+	schemesMu sync.RWMutex
+
+	// schemes maps the names of registered URL schemes to their openers.
+	schemes = map[string]Opener{}
+
+	// builtinSchemes are the URL schemes supported out of the box, which can't be registered.
+	builtinSchemes = []string{"http", "https", "s3", "gs", "az", "abfs", "abfss", "ia", "cc", "sftp", "file", ""}
+)
+
+// RegisterScheme registers opener for URL scheme name (like "hdfs"), so Open and Expand support URLs of this
+// scheme. Just like for the built-in schemes, failed attempts to open objects are retried using the configured
+// backoff strategy, interrupted downloads are resumed, and the configured timeouts apply (the header timeout to
+// Open itself). Errors that are marked using Permanent or that wrap fs.ErrNotExist or fs.ErrPermission are not
+// retried. RegisterScheme panics if the scheme is built-in or already registered, or if opener is nil.
+func RegisterScheme(name string, opener Opener) {
+	name = strings.ToLower(name)
+
+	if opener == nil {
+		panic("fetch: RegisterScheme opener is nil")
+	}
+
+	if slices.Contains(builtinSchemes, name) {
+		panic("fetch: RegisterScheme called for built-in scheme " + name)
+	}
+
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+
+	if _, ok := schemes[name]; ok {
+		panic("fetch: RegisterScheme called twice for scheme " + name)
+	}
+
+	schemes[name] = opener
+}
+
+// Permanent marks err as permanent, so failed attempts to open objects are not retried.
+func Permanent(err error) error {
+	return backoff.Permanent(err)
+}
+
+// registeredScheme returns the opener registered for the given URL scheme, or false if there is none.
+func registeredScheme(name string) (Opener, bool) {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	opener, ok := schemes[name]
+	return opener, ok
+}
+
+// newSchemeOpenFunc returns an open function that uses the given registered opener, applying timeouts.
+func newSchemeOpenFunc(opener Opener) openFunc {
+	return func(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+		// Apply overall timeout, and cancel if the object can't be opened within the header timeout
+		var cancel context.CancelFunc
+
+		if params.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, params.timeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+
+		var timer *time.Timer
+		if params.headerTimeout > 0 {
+			timer = time.AfterFunc(params.headerTimeout, cancel)
+		}
+
+		// Open object
+		var prevObj *Object
+		if prev != nil {
+			prevObj = &Object{
+				Size:         prev.size,
+				ETag:         prev.etag,
+				LastModified: prev.lastModified,
+				Version:      prev.version,
+				AcceptRanges: prev.acceptRanges,
+			}
+		}
+
+		obj, err := opener.Open(ctx, u, offset, length, prevObj)
+
+		// Misbehaving openers must not crash the caller
+		if (err == nil) && ((obj == nil) || (obj.Body == nil)) {
+			if timer != nil {
+				timer.Stop()
+			}
+
+			cancel()
+			return nil, backoff.Permanent(fmt.Errorf("%s opener returned no content [url=%s]", u.Scheme, redactURL(u.String())))
+		}
+
+		if (timer != nil) && !timer.Stop() && (err == nil) {
+			obj.Body.Close()
+			err = fmt.Errorf("open timed out [timeout=%s]", params.headerTimeout)
+		}
+
+		if err != nil {
+			cancel()
+
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				return nil, backoff.Permanent(fmt.Errorf("%s open [url=%s]: %w", u.Scheme, redactURL(u.String()), err))
+			}
+
+			return nil, fmt.Errorf("%s open [url=%s]: %w", u.Scheme, redactURL(u.String()), err)
+		}
+
+		return &object{
+			body:         newIdleTimeoutReader(obj.Body, params.idleTimeout, cancel),
+			size:         obj.Size,
+			etag:         obj.ETag,
+			lastModified: obj.LastModified,
+			version:      obj.Version,
+			acceptRanges: obj.AcceptRanges,
+		}, nil
+	}
+}
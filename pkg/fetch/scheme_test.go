@@ -0,0 +1,224 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestSchemeOpenerWithoutContent(t *testing.T) {
+	RegisterScheme("test-nil", OpenerFunc(func(_ context.Context, _ *url.URL, _ int64, _ int64, _ *Object) (*Object, error) {
+		return nil, nil
+	}))
+
+	RegisterScheme("test-nil-body", OpenerFunc(func(_ context.Context, _ *url.URL, _ int64, _ int64, _ *Object) (*Object, error) {
+		return &Object{Size: 42}, nil
+	}))
+
+	for _, addr := range []string{"test-nil://host/path", "test-nil-body://host/path"} {
+		_, err := Open(context.Background(), addr)
+		if err == nil {
+			t.Fatalf("Open(%q) succeeded, want error", addr)
+		}
+
+		scheme, _, _ := strings.Cut(addr, ":")
+		if !strings.Contains(err.Error(), scheme) {
+			t.Errorf("Open(%q) error %q does not name the scheme", addr, err)
+		}
+	}
+}
+
+// testOpener is an Opener serving a single object, recording all calls. The body of the first call fails half
+// way through.
+type testOpener struct {
+	mu      sync.Mutex
+	content string
+	etags   []string // ETag returned by each call (the last one is repeated)
+	calls   []testOpenerCall
+}
+
+// testOpenerCall records a call of testOpener.
+type testOpenerCall struct {
+	offset int64
+	length int64
+	prev   *Object
+}
+
+// Open opens the object at the given offset.
+func (to *testOpener) Open(_ context.Context, _ *url.URL, offset int64, length int64, prev *Object) (*Object, error) {
+	to.mu.Lock()
+	defer to.mu.Unlock()
+
+	to.calls = append(to.calls, testOpenerCall{offset: offset, length: length, prev: prev})
+
+	etag := to.etags[min(len(to.calls), len(to.etags))-1]
+
+	var body io.Reader = strings.NewReader(to.content[offset:])
+	if len(to.calls) == 1 {
+		body = io.MultiReader(strings.NewReader(to.content[:len(to.content)/2]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	}
+
+	return &Object{Body: io.NopCloser(body), Size: int64(len(to.content)), ETag: etag, Version: "1"}, nil
+}
+
+// TestSchemeOpenerResume tests that interrupted downloads of registered schemes are resumed at the offset
+// reached, passing the object as opened initially.
+func TestSchemeOpenerResume(t *testing.T) {
+	content := strings.Repeat("WARC/1.0\r\n", 100)
+
+	tests := []struct {
+		name    string
+		scheme  string
+		etags   []string
+		wantErr bool
+	}{
+		{name: "resumed", scheme: "test-resume", etags: []string{`"v1"`}},
+		{name: "changed", scheme: "test-resume-changed", etags: []string{`"v1"`, `"v2"`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := &testOpener{content: content, etags: tt.etags}
+			RegisterScheme(tt.scheme, to)
+
+			got, err := readAll(context.Background(), tt.scheme+"://host/file.warc", WithBackoffFunc(func() backoff.BackOff {
+				return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+			}))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got != content) {
+				t.Errorf("Open() content = %q, want %q", got, content)
+			}
+
+			// Resumed once, at the offset reached and with the initial object
+			want := []testOpenerCall{
+				{offset: 0, length: -1},
+				{offset: int64(len(content) / 2), length: -1, prev: &Object{Size: int64(len(content)), ETag: `"v1"`, Version: "1"}},
+			}
+
+			to.mu.Lock()
+			defer to.mu.Unlock()
+
+			if !reflect.DeepEqual(to.calls, want) {
+				t.Errorf("Open() calls = %+v, want %+v", to.calls, want)
+			}
+		})
+	}
+}
+
+// TestSchemeOpenerErrors tests that failed attempts of registered schemes are retried, unless permanent.
+func TestSchemeOpenerErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name      string
+		scheme    string
+		err       error
+		wantCalls int
+	}{
+		{name: "temporary", scheme: "test-err-temporary", err: errFailed, wantCalls: 3},
+		{name: "permanent", scheme: "test-err-permanent", err: Permanent(errFailed), wantCalls: 1},
+		{name: "not exist", scheme: "test-err-not-exist", err: fmt.Errorf("%w: %w", errFailed, fs.ErrNotExist), wantCalls: 1},
+		{name: "permission", scheme: "test-err-permission", err: fmt.Errorf("%w: %w", errFailed, fs.ErrPermission), wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+
+			RegisterScheme(tt.scheme, OpenerFunc(func(_ context.Context, _ *url.URL, _ int64, _ int64, _ *Object) (*Object, error) {
+				calls.Add(1)
+				return nil, tt.err
+			}))
+
+			_, err := Open(context.Background(), tt.scheme+"://host/file.warc", WithBackoffFunc(func() backoff.BackOff {
+				return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+			}))
+
+			if !errors.Is(err, errFailed) {
+				t.Errorf("Open() error = %v, want %v", err, errFailed)
+			}
+
+			if got := int(calls.Load()); got != tt.wantCalls {
+				t.Errorf("Open() called opener %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// testExpander is an Opener that expands addresses of its scheme into a fixed list of addresses.
+type testExpander struct {
+	OpenerFunc
+	urls []string // URLs passed to Expand
+}
+
+// Expand expands URL u into two archives below it.
+func (te *testExpander) Expand(_ context.Context, u *url.URL) ([]string, error) {
+	te.urls = append(te.urls, u.String())
+
+	return []string{u.String() + "a.warc.gz", u.String() + "b.warc.gz"}, nil
+}
+
+// TestSchemeExpander tests that registered schemes implementing Expander are expanded by Expand, and other
+// registered schemes are returned as they are.
+func TestSchemeExpander(t *testing.T) {
+	te := &testExpander{}
+	RegisterScheme("test-expand", te)
+
+	RegisterScheme("test-no-expand", OpenerFunc(func(_ context.Context, _ *url.URL, _ int64, _ int64, _ *Object) (*Object, error) {
+		return nil, errors.New("not implemented")
+	}))
+
+	tests := []struct {
+		name string
+		addr string
+		want []string
+	}{
+		{
+			name: "expander",
+			addr: "test-expand://bucket/prefix/",
+			want: []string{"test-expand://bucket/prefix/a.warc.gz", "test-expand://bucket/prefix/b.warc.gz"},
+		},
+		{
+			name: "expander with upper case scheme",
+			addr: "TEST-EXPAND://bucket/",
+			want: []string{"test-expand://bucket/a.warc.gz", "test-expand://bucket/b.warc.gz"},
+		},
+		{
+			name: "no expander",
+			addr: "test-no-expand://bucket/prefix/",
+			want: []string{"test-no-expand://bucket/prefix/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(context.Background(), tt.addr)
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if want := []string{"test-expand://bucket/prefix/", "test-expand://bucket/"}; !reflect.DeepEqual(te.urls, want) {
+		t.Errorf("Expand() called expander with %q, want %q", te.urls, want)
+	}
+}
@@ -0,0 +1,292 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// maxSessions is the maximum number of sessions kept. Beyond, the least recently used session is closed.
+	maxSessions = 16
+)
+
+var (
+	// sessions are the most recently used sessions, by the parameters they were loaded for.
+	sessions     = make(map[sessionKey]*session)
+	sessionsUsed uint64 // Number of times a session was used, ordering sessions by their last use
+	sessionsMu   sync.Mutex
+)
+
+// sessionKey wraps all parameters a session depends on.
+type sessionKey struct {
+	timeout           time.Duration
+	connectTimeout    time.Duration
+	headerTimeout     time.Duration
+	proxy             string
+	caBundle          string
+	clientCert        string
+	clientKey         string
+	netrcFile         string
+	cacheDir          string
+	sshKeyFile        string
+	sshKnownHostsFile string
+}
+
+// s3ClientKey wraps all parameters an Amazon S3 client depends on.
+type s3ClientKey struct {
+	endpoint  string
+	region    string
+	profile   string
+	roleARN   string
+	anonymous bool
+}
+
+// session wraps everything loaded or created for a set of parameters (like the CA bundle, the netrc file, or
+// clients), which is shared by all fetch operations using the same parameters.
+type session struct {
+	proxyURL   *url.URL
+	tlsConfig  *tls.Config
+	netrc      *netrc
+	sshSigners []ssh.Signer
+	httpClient *http.Client
+	lastUsed   uint64 // Value of sessionsUsed at the last use (guarded by sessionsMu)
+
+	mu              sync.Mutex
+	s3Clients       map[s3ClientKey]*s3.Client
+	gcsTokens       oauth2.TokenSource
+	sshDefaultOnce  sync.Once
+	sshDefaultKeys  []ssh.Signer
+	sshHostKeysOnce sync.Once
+	sshHostKeys     ssh.HostKeyCallback
+	sshHostKeysErr  error
+
+	sftpMu     sync.Mutex
+	sftpConns  map[string][]*sftpConn // Idle SFTP connections, by user and host
+	sftpClosed bool                   // Set once the session is closed, so released connections are not kept
+}
+
+// getSession returns the session for the given parameters, loading it on first use. Sessions that failed to
+// load are not kept, so the error is reported again. Only the most recently used sessions are kept, so programs
+// using many different parameters don't pile up clients and connections.
+func getSession(p *params) (*session, error) {
+	key := sessionKey{
+		timeout:           p.timeout,
+		connectTimeout:    p.connectTimeout,
+		headerTimeout:     p.headerTimeout,
+		proxy:             p.proxy,
+		caBundle:          p.caBundle,
+		clientCert:        p.clientCert,
+		clientKey:         p.clientKey,
+		netrcFile:         p.netrcFile,
+		cacheDir:          p.cacheDir,
+		sshKeyFile:        p.sshKeyFile,
+		sshKnownHostsFile: p.sshKnownHostsFile,
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	sessionsUsed++
+
+	if s, ok := sessions[key]; ok {
+		s.lastUsed = sessionsUsed
+		return s, nil
+	}
+
+	// Load everything the parameters refer to
+	err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		proxyURL:   p.proxyURL,
+		tlsConfig:  p.tlsConfig,
+		netrc:      p.netrc,
+		sshSigners: p.sshSigners,
+		httpClient: newHTTPClient(p),
+		s3Clients:  make(map[s3ClientKey]*s3.Client),
+		sftpConns:  make(map[string][]*sftpConn),
+		lastUsed:   sessionsUsed,
+	}
+
+	// Close least recently used session, if there are too many
+	if len(sessions) >= maxSessions {
+		var lruKey sessionKey
+		var lru *session
+
+		for k, ls := range sessions {
+			if (lru == nil) || (ls.lastUsed < lru.lastUsed) {
+				lruKey, lru = k, ls
+			}
+		}
+
+		delete(sessions, lruKey)
+		lru.close()
+	}
+
+	sessions[key] = s
+
+	return s, nil
+}
+
+// close closes the idle connections of the session. Fetch operations still using the session keep working, but
+// their SFTP connections are closed once released instead of being kept for later requests.
+func (s *session) close() {
+	s.httpClient.CloseIdleConnections()
+
+	s.sftpMu.Lock()
+	conns := s.sftpConns
+	s.sftpConns = make(map[string][]*sftpConn)
+	s.sftpClosed = true
+	s.sftpMu.Unlock()
+
+	for _, cs := range conns {
+		for _, c := range cs {
+			c.idle.Stop()
+			c.close()
+		}
+	}
+}
+
+// s3Client returns the Amazon S3 client for the S3 options of p, creating it on first use.
+func (s *session) s3Client(ctx context.Context, p *params) (*s3.Client, error) {
+	key := s3ClientKey{
+		endpoint:  p.s3Endpoint,
+		region:    p.s3Region,
+		profile:   p.s3Profile,
+		roleARN:   p.s3RoleARN,
+		anonymous: p.s3Anonymous,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.s3Clients[key]; ok {
+		return c, nil
+	}
+
+	c, err := newS3Client(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.s3Clients[key] = c
+
+	return c, nil
+}
+
+// gcsTokenSource returns the source of GCS access tokens, based on the application default credentials, creating
+// it on first use.
+func (s *session) gcsTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gcsTokens == nil {
+		// Tokens are refreshed long after the current operation is done
+		ts, err := google.DefaultTokenSource(context.WithoutCancel(ctx), gcsReadOnlyScope)
+		if err != nil {
+			return nil, err
+		}
+
+		s.gcsTokens = ts
+	}
+
+	return s.gcsTokens, nil
+}
+
+// sshKeys returns the private keys to authenticate with via SSH: the configured one, or the default ones (which
+// are read on first use, skipping missing or unreadable ones).
+func (s *session) sshKeys(p *params) []ssh.Signer {
+	if p.sshKeyFile != "" {
+		return s.sshSigners
+	}
+
+	s.sshDefaultOnce.Do(func() {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+
+		for _, name := range sshDefaultKeyFiles {
+			if signer, err := readSSHKey(filepath.Join(home, ".ssh", name)); err == nil {
+				s.sshDefaultKeys = append(s.sshDefaultKeys, signer)
+			}
+		}
+	})
+
+	return s.sshDefaultKeys
+}
+
+// sshHostKeyCallback returns the callback checking host keys against the known hosts file, which is read on first
+// use.
+func (s *session) sshHostKeyCallback(p *params) (ssh.HostKeyCallback, error) {
+	s.sshHostKeysOnce.Do(func() {
+		s.sshHostKeys, s.sshHostKeysErr = readKnownHosts(p.sshKnownHostsFile)
+	})
+
+	return s.sshHostKeys, s.sshHostKeysErr
+}
+
+// takeSFTPConn returns an idle SFTP connection for the given user and host, or nil if there is none.
+func (s *session) takeSFTPConn(key string) *sftpConn {
+	s.sftpMu.Lock()
+	defer s.sftpMu.Unlock()
+
+	conns := s.sftpConns[key]
+	if len(conns) == 0 {
+		return nil
+	}
+
+	c := conns[len(conns)-1]
+	s.sftpConns[key] = conns[:len(conns)-1]
+
+	c.idle.Stop()
+
+	return c
+}
+
+// putSFTPConn keeps the SFTP connection c for the given user and host for later requests, closing it if it stays
+// unused for too long (or right away, if the session is closed).
+func (s *session) putSFTPConn(key string, c *sftpConn) {
+	s.sftpMu.Lock()
+
+	if s.sftpClosed {
+		s.sftpMu.Unlock()
+		c.close()
+
+		return
+	}
+
+	defer s.sftpMu.Unlock()
+
+	c.idle = time.AfterFunc(sftpIdleConnTimeout, func() {
+		s.sftpMu.Lock()
+		conns := s.sftpConns[key]
+		i := slices.Index(conns, c)
+
+		if i >= 0 {
+			s.sftpConns[key] = slices.Delete(conns, i, i+1)
+		}
+
+		s.sftpMu.Unlock()
+
+		if i >= 0 {
+			c.close()
+		}
+	})
+
+	s.sftpConns[key] = append(s.sftpConns[key], c)
+}
@@ -0,0 +1,205 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestGetSession tests that sessions are loaded once, and shared by all fetch operations using the same
+// parameters.
+func TestGetSession(t *testing.T) {
+	dir := t.TempDir()
+
+	netrcFile := filepath.Join(dir, "netrc")
+
+	err := os.WriteFile(netrcFile, []byte("machine example.com login user password secret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load session
+	p1, err := newParams([]Option{WithNetrc(netrcFile), WithCache(filepath.Join(dir, "cache"), 0)})
+	if err != nil {
+		t.Fatalf("newParams() error = %v", err)
+	}
+
+	// Same parameters share the session, without loading files again
+	err = os.Remove(netrcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := newParams([]Option{WithNetrc(netrcFile), WithCache(filepath.Join(dir, "cache"), 0)})
+	if err != nil {
+		t.Fatalf("newParams() with same options error = %v", err)
+	}
+
+	if p1.session != p2.session {
+		t.Errorf("newParams() with same options created a new session")
+	}
+
+	if p2.netrc != p1.netrc {
+		t.Errorf("newParams() with same options did not share netrc")
+	}
+
+	if p2.session.httpClient != p1.session.httpClient {
+		t.Errorf("newParams() with same options did not share the HTTP client")
+	}
+
+	// Different parameters load a new session, reporting errors
+	_, err = newParams([]Option{WithNetrc(netrcFile)})
+	if err == nil {
+		t.Errorf("newParams() with missing netrc file error = nil, want error")
+	}
+}
+
+// TestSessionReusesConnections tests that fetch operations using the same parameters share the HTTP client, and
+// reuse its connections.
+func TestSessionReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "content")
+	}))
+
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+
+	srv.Start()
+	defer srv.Close()
+
+	for i := range 3 {
+		r, err := Open(context.Background(), srv.URL+"/file.txt", WithConnectTimeout(7*time.Second))
+		if err != nil {
+			t.Fatalf("Open() #%d error = %v", i, err)
+		}
+
+		_, err = io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() #%d error = %v", i, err)
+		}
+
+		r.Close()
+	}
+
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Open() used %d connections, want 1", n)
+	}
+}
+
+// TestSessionEviction tests that only the most recently used sessions are kept, and that SFTP connections of
+// evicted sessions are closed: idle ones right away, ones in use once released.
+func TestSessionEviction(t *testing.T) {
+	// Start with an empty cache
+	sessionsMu.Lock()
+	saved := sessions
+	sessions = make(map[sessionKey]*session)
+	sessionsMu.Unlock()
+
+	t.Cleanup(func() {
+		sessionsMu.Lock()
+		sessions = saved
+		sessionsMu.Unlock()
+	})
+
+	// newSession returns the session for the given options
+	newSession := func(opts ...Option) *session {
+		p, err := newParams(opts)
+		if err != nil {
+			t.Fatalf("newParams() error = %v", err)
+		}
+
+		return p.session
+	}
+
+	// waitHangups waits for the SFTP server to see the given number of closed connections
+	waitHangups := func(ss *sftpServer, want int32) {
+		deadline := time.Now().Add(5 * time.Second)
+
+		for (ss.hangups.Load() != want) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if n := ss.hangups.Load(); n != want {
+			t.Errorf("SSH connections closed = %d, want %d", n, want)
+		}
+	}
+
+	content := "WARC/1.0\r\n" + strings.Repeat("sftp content\n", 1000)
+	ss, addr, opts := sftpTestSetup(t, content)
+
+	first := newSession(WithConnectTimeout(time.Second))
+
+	// One SFTP connection in use, one idle
+	r, err := Open(context.Background(), addr, opts...)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	defer r.Close()
+
+	_, err = readAll(context.Background(), addr, opts...)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	sftpSession := newSession(opts...)
+
+	if n := ss.handshakes.Load(); n != 2 {
+		t.Fatalf("SSH handshakes = %d, want 2", n)
+	}
+
+	if n := ss.hangups.Load(); n != 0 {
+		t.Fatalf("SSH connections closed = %d before eviction, want 0", n)
+	}
+
+	// Fill the cache, with the first session used more recently than the SFTP session
+	if newSession(WithConnectTimeout(time.Second)) != first {
+		t.Errorf("newParams() with same options created a new session")
+	}
+
+	for i := 2; i <= maxSessions; i++ {
+		newSession(WithConnectTimeout(time.Duration(i) * time.Second))
+	}
+
+	sessionsMu.Lock()
+	n := len(sessions)
+	sessionsMu.Unlock()
+
+	if n != maxSessions {
+		t.Errorf("sessions kept = %d, want %d", n, maxSessions)
+	}
+
+	if newSession(WithConnectTimeout(time.Second)) != first {
+		t.Errorf("recently used session was evicted")
+	}
+
+	// The idle connection of the evicted session is closed right away
+	waitHangups(ss, 1)
+
+	// The connection in use is closed once released
+	_, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	r.Close()
+	waitHangups(ss, 2)
+
+	// The session is loaded again on next use
+	if newSession(opts...) == sftpSession {
+		t.Errorf("least recently used session was not evicted")
+	}
+}
@@ -0,0 +1,335 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// sftpDefaultPort is the default port of SFTP servers.
+	sftpDefaultPort = "22"
+
+	// sftpIdleConnTimeout is the duration after which unused SFTP connections are closed.
+	sftpIdleConnTimeout = 30 * time.Second
+)
+
+var (
+	// sshDefaultKeyFiles are the default private key files (below "~/.ssh") tried if no key file is set.
+	sshDefaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+)
+
+// sftpConn wraps an SSH connection along with its SFTP session, which is kept open for later requests.
+type sftpConn struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	closed atomic.Bool
+	idle   *time.Timer // Closes the connection if it stays unused for too long (see session.putSFTPConn)
+}
+
+// close closes the SSH connection and the SFTP session. The connection is closed before the SFTP client, which
+// would otherwise wait for the server to end the session.
+func (c *sftpConn) close() {
+	if c.closed.CompareAndSwap(false, true) {
+		c.conn.Close()
+		c.client.Close()
+	}
+}
+
+// sftpFile wraps a file opened via SFTP, handing the connection back for later requests once closed.
+type sftpFile struct {
+	io.Reader
+	file    *sftp.File
+	conn    *sftpConn
+	stop    func() bool // Stops aborting on the end of the context, returning false if already aborted
+	release func()      // Hands the connection back for later requests
+	failed  bool        // Set if reading failed, so the connection is not trusted anymore
+}
+
+// Read reads up to len(p) bytes into p.
+func (sf *sftpFile) Read(p []byte) (int, error) {
+	n, err := sf.Reader.Read(p)
+	if (err != nil) && (err != io.EOF) {
+		sf.failed = true
+	}
+
+	return n, err
+}
+
+// Close closes the file, and either hands the connection back or closes it if anything went wrong.
+func (sf *sftpFile) Close() error {
+	err := sf.file.Close()
+
+	if sf.stop() && (err == nil) && !sf.failed && !sf.conn.closed.Load() {
+		sf.release()
+		return nil
+	}
+
+	sf.conn.close()
+
+	return err
+}
+
+// openSFTPURL returns the given SFTP URL ("sftp://user@host:port/path"), starting at the given offset and limited
+// to length bytes (unless negative). SSH connections are authenticated by private key (or the password of the
+// URL), with the host key checked against the known hosts file, and are kept open for later calls.
+func openSFTPURL(ctx context.Context, u *url.URL, params *params, offset int64, length int64, prev *object) (*object, error) {
+	// Apply overall timeout
+	var cancel context.CancelFunc
+
+	if params.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, params.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	for {
+		// Reuse idle connection, or connect
+		c := params.session.takeSFTPConn(sftpConnKey(u))
+		pooled := (c != nil)
+
+		if !pooled {
+			conn, err := dialSSH(ctx, u, params)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+
+			client, err := sftp.NewClient(conn)
+			if err != nil {
+				conn.Close()
+				cancel()
+				return nil, fmt.Errorf("SFTP session [url=%s]: %w", redactURL(u.String()), err)
+			}
+
+			c = &sftpConn{conn: conn, client: client}
+		}
+
+		// Open file
+		obj, err := openSFTPFile(ctx, u, params, c, offset, length, cancel)
+		if err == nil {
+			return obj, nil
+		}
+
+		// Idle connections may have been closed by the server in the meantime, so try another one
+		var perr *backoff.PermanentError
+		if pooled && !errors.As(err, &perr) && (ctx.Err() == nil) {
+			continue
+		}
+
+		cancel()
+		return nil, err
+	}
+}
+
+// openSFTPFile opens the file of URL u via SFTP connection c, starting at the given offset and limited to length
+// bytes (unless negative). The connection is closed if anything fails, or once the context is done (which cancel
+// ends).
+func openSFTPFile(ctx context.Context, u *url.URL, params *params, c *sftpConn, offset int64, length int64, cancel context.CancelFunc) (*object, error) {
+	// Closing the connection aborts everything in progress once the context is done
+	stop := context.AfterFunc(ctx, c.close)
+
+	abort := func() {
+		stop()
+		c.close()
+	}
+
+	// Open file
+	f, err := c.client.Open(u.Path)
+	if err != nil {
+		abort()
+		return nil, classifySFTPError(fmt.Errorf("SFTP open [url=%s]: %w", redactURL(u.String()), err))
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		abort()
+		return nil, classifySFTPError(fmt.Errorf("SFTP stat [url=%s]: %w", redactURL(u.String()), err))
+	}
+
+	if !fi.Mode().IsRegular() {
+		abort()
+		return nil, backoff.Permanent(fmt.Errorf("SFTP object is not a file [url=%s]", redactURL(u.String())))
+	}
+
+	// Start at offset
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		abort()
+		return nil, fmt.Errorf("SFTP seek [url=%s, offset=%d]: %w", redactURL(u.String()), offset, err)
+	}
+
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+
+	body := &sftpFile{
+		Reader:  r,
+		file:    f,
+		conn:    c,
+		stop:    stop,
+		release: func() { params.session.putSFTPConn(sftpConnKey(u), c) },
+	}
+
+	return &object{
+		body:         newIdleTimeoutReader(body, params.idleTimeout, cancel),
+		size:         fi.Size(),
+		lastModified: fi.ModTime().UTC().Format(http.TimeFormat),
+		acceptRanges: true,
+	}, nil
+}
+
+// sftpConnKey returns the key of SFTP connections for URL u, which can be reused for URLs of the same user and
+// host.
+func sftpConnKey(u *url.URL) string {
+	return u.User.String() + "@" + u.Host
+}
+
+// dialSSH establishes an SSH connection to the host of URL u, honoring the connect and header timeouts (the
+// latter for the SSH handshake).
+func dialSSH(ctx context.Context, u *url.URL, params *params) (*ssh.Client, error) {
+	// Determine user and address
+	username := u.User.Username()
+	if username == "" {
+		if cu, err := user.Current(); err == nil {
+			username = cu.Username
+		}
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = sftpDefaultPort
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	// Host key checking
+	hostKeyCallback, err := params.session.sshHostKeyCallback(params)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+
+	// Authentication
+	auth := sshAuthMethods(u, params)
+	if len(auth) == 0 {
+		return nil, backoff.Permanent(fmt.Errorf("no SSH key found [url=%s]", redactURL(u.String())))
+	}
+
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         params.connectTimeout,
+	}
+
+	// Connect
+	dialer := &net.Dialer{Timeout: params.connectTimeout, KeepAlive: 30 * time.Second}
+
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("SSH connect [addr=%s]: %w", addr, err)
+	}
+
+	// Handshake
+	if params.headerTimeout > 0 {
+		_ = nc.SetDeadline(time.Now().Add(params.headerTimeout))
+	}
+
+	sc, chans, reqs, err := ssh.NewClientConn(nc, addr, config)
+	if err != nil {
+		nc.Close()
+
+		// Authentication and host key failures won't go away by retrying
+		var kerr *knownhosts.KeyError
+		if errors.As(err, &kerr) || isSSHAuthError(err) {
+			return nil, backoff.Permanent(fmt.Errorf("SSH handshake [addr=%s]: %w", addr, err))
+		}
+
+		return nil, fmt.Errorf("SSH handshake [addr=%s]: %w", addr, err)
+	}
+
+	_ = nc.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sc, chans, reqs), nil
+}
+
+// readKnownHosts returns the callback checking host keys against the known hosts file at path (or
+// "~/.ssh/known_hosts", if empty).
+func readKnownHosts(path string) (ssh.HostKeyCallback, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("find known hosts file: %w", err)
+		}
+
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts file: %w", err)
+	}
+
+	return callback, nil
+}
+
+// sshAuthMethods returns the methods to authenticate with: the configured private key (or the default ones
+// if none is configured), and the password of URL u, if any.
+func sshAuthMethods(u *url.URL, params *params) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+
+	// Private keys
+	if signers := params.session.sshKeys(params); len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	// Password
+	if password, ok := u.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+
+	return methods
+}
+
+// readSSHKey reads the (unencrypted) private key file at path.
+func readSSHKey(path string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(pem)
+}
+
+// isSSHAuthError returns true if the SSH handshake failed because no authentication method was accepted.
+func isSSHAuthError(err error) bool {
+	var serr *ssh.ServerAuthError
+	return errors.As(err, &serr) || ((err != nil) && strings.Contains(err.Error(), "unable to authenticate"))
+}
+
+// classifySFTPError turns the SFTP error err into a permanent error, if it is not worth a retry (like a missing
+// file or denied access).
+func classifySFTPError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return backoff.Permanent(err)
+	}
+
+	return err
+}
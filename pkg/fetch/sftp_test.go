@@ -0,0 +1,427 @@
+package fetch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	// errPermissionDenied is returned by sftpServer for rejected authentication attempts.
+	errPermissionDenied = errors.New("permission denied")
+)
+
+const (
+	// sftpTestUser is the user accepted by sftpServer.
+	sftpTestUser = "troll"
+
+	// sftpTestPassword is the password accepted by sftpServer.
+	sftpTestPassword = "secret"
+)
+
+// sftpServer is an in-process SSH server, serving the local file system via SFTP (read-only).
+type sftpServer struct {
+	listener   net.Listener
+	hostKey    ssh.Signer
+	handshakes atomic.Int32 // Number of successful SSH handshakes
+	hangups    atomic.Int32 // Number of connections closed by clients (or by dropConns)
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn // Open connections
+}
+
+// newSFTPServer starts an SSH server accepting sftpTestUser, authenticated by the given public key or by
+// sftpTestPassword.
+func newSFTPServer(t *testing.T, clientKey ssh.PublicKey) *sftpServer {
+	t.Helper()
+
+	hostKey := newSSHSigner(t)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if (cm.User() == sftpTestUser) && (clientKey != nil) && (string(key.Marshal()) == string(clientKey.Marshal())) {
+				return &ssh.Permissions{}, nil
+			}
+
+			return nil, errPermissionDenied
+		},
+		PasswordCallback: func(cm ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if (cm.User() == sftpTestUser) && (string(password) == sftpTestPassword) {
+				return &ssh.Permissions{}, nil
+			}
+
+			return nil, errPermissionDenied
+		},
+	}
+
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss := &sftpServer{listener: l, hostKey: hostKey}
+
+	go ss.serve(config)
+
+	t.Cleanup(func() {
+		l.Close()
+		ss.dropConns()
+	})
+
+	return ss
+}
+
+// serve accepts connections until the listener is closed.
+func (ss *sftpServer) serve(config *ssh.ServerConfig) {
+	for {
+		nc, err := ss.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go ss.serveConn(nc, config)
+	}
+}
+
+// serveConn serves SFTP sessions on the SSH connection nc.
+func (ss *sftpServer) serveConn(nc net.Conn, config *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		nc.Close()
+		return
+	}
+
+	ss.handshakes.Add(1)
+
+	ss.mu.Lock()
+	ss.conns = append(ss.conns, sc)
+	ss.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			_ = nch.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, creqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+
+		go ss.serveSession(ch, creqs)
+	}
+
+	ss.hangups.Add(1)
+}
+
+// serveSession serves the SFTP subsystem on session channel ch.
+func (ss *sftpServer) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range reqs {
+		ok := (req.Type == "subsystem") && (len(req.Payload) > 4) && (string(req.Payload[4:]) == "sftp")
+		_ = req.Reply(ok, nil)
+
+		if !ok {
+			continue
+		}
+
+		go ssh.DiscardRequests(reqs)
+
+		server, err := sftp.NewServer(ch, sftp.ReadOnly())
+		if err != nil {
+			return
+		}
+
+		_ = server.Serve()
+		server.Close()
+
+		return
+	}
+}
+
+// dropConns closes all open connections, like a server dropping idle connections.
+func (ss *sftpServer) dropConns() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, sc := range ss.conns {
+		sc.Close()
+	}
+
+	ss.conns = nil
+}
+
+// addr returns the address of the server.
+func (ss *sftpServer) addr() string {
+	return ss.listener.Addr().String()
+}
+
+// newSSHSigner returns a new ed25519 key.
+func newSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+// writeSSHKeyFile writes a new (unencrypted) ed25519 private key to the file at path, and returns its public key.
+func writeSSHKeyFile(t *testing.T, path string) ssh.PublicKey {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer.PublicKey()
+}
+
+// writeKnownHostsFile writes a known hosts file listing the given host key for the server at addr.
+func writeKnownHostsFile(t *testing.T, path string, addr string, hostKey ssh.PublicKey) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sftpTestSetup starts an SFTP server serving a file with the given content, and returns the server, the URL of
+// the file, and the options to access it by private key.
+func sftpTestSetup(t *testing.T, content string) (*sftpServer, string, []Option) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "file.warc"), []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Server
+	keyFile := filepath.Join(dir, "id_ed25519")
+	ss := newSFTPServer(t, writeSSHKeyFile(t, keyFile))
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	writeKnownHostsFile(t, knownHostsFile, ss.addr(), ss.hostKey.PublicKey())
+
+	opts := []Option{
+		WithSSHKeyFile(keyFile),
+		WithSSHKnownHostsFile(knownHostsFile),
+		WithBackoffFunc(func() backoff.BackOff { return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2) }),
+	}
+
+	return ss, "sftp://" + sftpTestUser + "@" + ss.addr() + filepath.ToSlash(dir) + "/file.warc", opts
+}
+
+// TestOpenSFTP tests fetching files from an in-process SFTP server.
+func TestOpenSFTP(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("sftp content\n", 1000)
+
+	tests := []struct {
+		name    string
+		addr    func(addr string) string // Returns the address to open, given the address of the file
+		opts    func(opts []Option, dir string, addr string) []Option
+		wantErr bool
+	}{
+		{name: "private key"},
+		{
+			name: "password",
+			addr: func(addr string) string {
+				return strings.Replace(addr, sftpTestUser+"@", sftpTestUser+":"+sftpTestPassword+"@", 1)
+			},
+			opts: func(opts []Option, dir string, addr string) []Option {
+				return append(opts, WithSSHKeyFile(""))
+			},
+		},
+		{
+			name: "wrong password",
+			addr: func(addr string) string {
+				return strings.Replace(addr, sftpTestUser+"@", sftpTestUser+":wrong@", 1)
+			},
+			opts: func(opts []Option, dir string, addr string) []Option {
+				return append(opts, WithSSHKeyFile(""))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown user",
+			addr: func(addr string) string {
+				return strings.Replace(addr, sftpTestUser+"@", "mallory@", 1)
+			},
+			wantErr: true,
+		},
+		{
+			name: "changed host key",
+			opts: func(opts []Option, dir string, addr string) []Option {
+				// Known hosts file listing another key for the server
+				path := filepath.Join(dir, "known_hosts")
+				writeKnownHostsFile(t, path, addr, newSSHSigner(t).PublicKey())
+
+				return append(opts, WithSSHKnownHostsFile(path))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			addr:    func(addr string) string { return strings.Replace(addr, "file.warc", "missing.warc", 1) },
+			wantErr: true,
+		},
+		{
+			name:    "directory",
+			addr:    func(addr string) string { return strings.TrimSuffix(addr, "/file.warc") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without key file, the default keys of the (empty) home directory are tried
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+
+			ss, addr, opts := sftpTestSetup(t, content)
+
+			if tt.addr != nil {
+				addr = tt.addr(addr)
+			}
+
+			if tt.opts != nil {
+				opts = tt.opts(opts, home, ss.addr())
+			}
+
+			got, err := readAll(context.Background(), addr, opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (got != content) {
+				t.Errorf("Open() content = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// TestSFTPConnReuse tests that SFTP connections are kept open for later requests, and replaced once the server
+// dropped them.
+func TestSFTPConnReuse(t *testing.T) {
+	content := "WARC/1.0\r\n" + strings.Repeat("sftp content\n", 1000)
+
+	ss, addr, opts := sftpTestSetup(t, content)
+
+	// fetch reads the file, and returns the number of SSH handshakes so far
+	fetch := func() int32 {
+		got, err := readAll(context.Background(), addr, opts...)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		if got != content {
+			t.Fatalf("Open() content = %q, want %q", got, content)
+		}
+
+		return ss.handshakes.Load()
+	}
+
+	for i := 0; i < 3; i++ {
+		if n := fetch(); n != 1 {
+			t.Errorf("SSH handshakes after %d fetches = %d, want 1", i+1, n)
+		}
+	}
+
+	// Dropped connections are replaced
+	ss.dropConns()
+
+	if n := fetch(); n != 2 {
+		t.Errorf("SSH handshakes after dropped connection = %d, want 2", n)
+	}
+
+	// Connections of failed requests are not reused
+	_, err := readAll(context.Background(), strings.Replace(addr, "file.warc", "missing.warc", 1), opts...)
+	if err == nil {
+		t.Fatalf("Open() of missing file succeeded")
+	}
+
+	if n := fetch(); n != 3 {
+		t.Errorf("SSH handshakes after failed request = %d, want 3", n)
+	}
+}
+
+// TestSFTPParallel tests downloading large files via multiple SFTP connections, which are kept open for later
+// requests.
+func TestSFTPParallel(t *testing.T) {
+	const connections = 3
+
+	data := make([]byte, 3*parallelChunkSize+1234)
+	_, _ = rand.Read(data)
+
+	ss, addr, opts := sftpTestSetup(t, string(data))
+	opts = append(opts, WithConnections(connections))
+
+	for i := 0; i < 2; i++ {
+		r, err := Open(context.Background(), addr, opts...)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+
+		r.Close()
+
+		if string(got) != string(data) {
+			t.Fatalf("ReadAll() content differs, got %d bytes, want %d bytes", len(got), len(data))
+		}
+	}
+
+	// At most one connection per worker, plus the one of the initial request
+	if n := ss.handshakes.Load(); (n < 2) || (n > connections+1) {
+		t.Errorf("SSH handshakes = %d, want 2 to %d", n, connections+1)
+	}
+}
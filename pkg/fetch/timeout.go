@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrStalled is returned if no data was received within the idle timeout.
+	ErrStalled = errors.New("download stalled")
+)
+
+// idleTimeoutReader wraps a content reader, canceling the underlying request if no data was received within
+// the idle timeout.
+type idleTimeoutReader struct {
+	body    io.ReadCloser
+	cancel  context.CancelFunc
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+// newIdleTimeoutReader wraps body, calling cancel if a single read takes longer than timeout (unless timeout is
+// zero). The function cancel is always called on Close.
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) io.ReadCloser {
+	ir := &idleTimeoutReader{body: body, cancel: cancel, timeout: timeout}
+
+	if timeout > 0 {
+		ir.timer = time.AfterFunc(timeout, func() {
+			ir.stalled.Store(true)
+			cancel()
+		})
+
+		ir.timer.Stop()
+	}
+
+	return ir
+}
+
+// Read reads up to len(p) bytes into p.
+func (ir *idleTimeoutReader) Read(p []byte) (int, error) {
+	// Bail if already stalled
+	if ir.stalled.Load() {
+		return 0, fmt.Errorf("%w [timeout=%s]", ErrStalled, ir.timeout)
+	}
+
+	// Read, with watchdog armed
+	if ir.timer != nil {
+		ir.timer.Reset(ir.timeout)
+	}
+
+	n, err := ir.body.Read(p)
+
+	if ir.timer != nil {
+		ir.timer.Stop()
+	}
+
+	if (err != nil) && ir.stalled.Load() {
+		return n, fmt.Errorf("%w [timeout=%s]", ErrStalled, ir.timeout)
+	}
+
+	return n, err
+}
+
+// Close closes the content reader and releases the underlying request.
+func (ir *idleTimeoutReader) Close() error {
+	if ir.timer != nil {
+		ir.timer.Stop()
+	}
+
+	err := ir.body.Close()
+	ir.cancel()
+
+	return err
+}
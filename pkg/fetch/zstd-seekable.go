@@ -0,0 +1,390 @@
+package fetch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	magicZStdSeekTableFrame  = "\x5e\x2a\x4d\x18" // Magic bytes for the ZStd skippable frame holding the seek table
+	magicZStdSeekTableFooter = "\xb1\xea\x92\x8f" // Magic bytes for the ZStd seek table footer (ZStd seekable format)
+
+	zstdSkippableFrameHeaderSize = 8    // Size of a ZStd skippable frame header (magic + frame size)
+	zstdSeekTableFooterSize      = 9    // Size of the ZStd seek table footer (frame count + descriptor + magic)
+	zstdSeekTableChecksumFlag    = 0x80 // Seek table descriptor flag, set if entries contain checksums
+
+	// maxZStdSeekableFrameSize is the maximum decompressed size of a single frame that will be decoded in
+	// parallel. Streams with bigger frames are decoded sequentially, to keep memory consumption in check.
+	maxZStdSeekableFrameSize = 64 * 1024 * 1024
+)
+
+var (
+	// ErrNotSeekableZStd is returned if a stream is not in the ZStd seekable format.
+	ErrNotSeekableZStd = errors.New("not a seekable ZStd stream")
+)
+
+// zstdFrame describes a single frame of a seekable ZStd stream.
+type zstdFrame struct {
+	compressedOffset   int64 // Offset of the frame within the compressed stream
+	compressedSize     int64 // Size of the compressed frame
+	decompressedOffset int64 // Offset of the frame content within the decompressed stream
+	decompressedSize   int64 // Size of the decompressed frame content
+}
+
+// zstdFrameResult wraps the result of decoding a single frame.
+type zstdFrameResult struct {
+	data []byte
+	err  error
+}
+
+// SeekableZStdReader decodes a ZStd stream in the seekable format (as described in the ZStd repository under
+// contrib/seekable_format). As all frames of such a stream are independent, they are decoded in parallel, and
+// any position of the decompressed stream can be reached without decoding from the start.
+type SeekableZStdReader struct {
+	ra          io.ReaderAt
+	closer      io.Closer
+	frames      []zstdFrame
+	size        int64
+	decoder     *zstd.Decoder
+	concurrency int
+
+	offset  int64                      // Current offset within the decompressed stream
+	current []byte                     // Remaining decompressed content of the current frame
+	results chan chan *zstdFrameResult // Ordered results of the decoding pipeline, or nil
+	stop    chan struct{}              // Closing this channel stops the decoding pipeline
+}
+
+// NewSeekableZStdReader returns a new reader for the seekable ZStd stream ra of the given compressed size. If
+// the stream does not end with a seek table, ErrNotSeekableZStd is returned. A custom dictionary prepended in a
+// skippable frame (like by megawarc) is used for all frames.
+func NewSeekableZStdReader(ra io.ReaderAt, size int64) (*SeekableZStdReader, error) {
+	// Read custom dictionary, if any (an empty stream starts with the seek table right away)
+	var dict []byte
+	var start int64
+
+	var magic [4]byte
+
+	_, err := ra.ReadAt(magic[:], 0)
+	if (err == nil) && isZStdSkippableFrame(string(magic[:])) && (string(magic[:]) != magicZStdSeekTableFrame) {
+		dict, start, err = readZStdCustomDict(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse seek table
+	frames, err := readZStdSeekTable(ra, start, size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create decoder that can be used concurrently
+	concurrency := runtime.GOMAXPROCS(0)
+
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(concurrency)}
+	if dict != nil {
+		opts = append(opts, zstd.WithDecoderDicts(dict))
+	}
+
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create ZStd decoder: %w", err)
+	}
+
+	// Compute decompressed size
+	var decompressedSize int64
+
+	if len(frames) > 0 {
+		last := frames[len(frames)-1]
+		decompressedSize = last.decompressedOffset + last.decompressedSize
+	}
+
+	return &SeekableZStdReader{
+		ra:          ra,
+		frames:      frames,
+		size:        decompressedSize,
+		decoder:     dec,
+		concurrency: concurrency,
+	}, nil
+}
+
+// Size returns the size of the decompressed stream.
+func (zr *SeekableZStdReader) Size() int64 {
+	return zr.size
+}
+
+// Read reads the next len(p) bytes of the decompressed stream into p.
+func (zr *SeekableZStdReader) Read(p []byte) (int, error) {
+	for len(zr.current) == 0 {
+		// Bail if we reached the end
+		if zr.offset >= zr.size {
+			return 0, io.EOF
+		}
+
+		// Start decoding pipeline, if necessary
+		if zr.results == nil {
+			zr.startPipeline(zr.findFrame(zr.offset))
+		}
+
+		// Wait for the next decoded frame
+		resCh, ok := <-zr.results
+		if !ok {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		res := <-resCh
+		if res.err != nil {
+			return 0, res.err
+		}
+
+		zr.current = res.data
+	}
+
+	// Copy from current frame
+	n := copy(p, zr.current)
+
+	zr.current = zr.current[n:]
+	zr.offset += int64(n)
+
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes of the decompressed stream, starting at offset off, into p. It does not affect
+// the offset used by Read and can be called concurrently.
+func (zr *SeekableZStdReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	var n int
+
+	for i := zr.findFrame(off); (n < len(p)) && (i < len(zr.frames)); i++ {
+		// Decode frame
+		data, err := zr.decodeFrame(i)
+		if err != nil {
+			return n, err
+		}
+
+		// Copy the relevant part of the frame
+		n += copy(p[n:], data[off+int64(n)-zr.frames[i].decompressedOffset:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Seek sets the offset for the next Read within the decompressed stream.
+func (zr *SeekableZStdReader) Seek(offset int64, whence int) (int64, error) {
+	// Compute absolute offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += zr.offset
+	case io.SeekEnd:
+		offset += zr.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	// Restart decoding pipeline at the new offset
+	if offset != zr.offset {
+		zr.stopPipeline()
+
+		zr.offset = offset
+		zr.current = nil
+
+		if i := zr.findFrame(offset); i < len(zr.frames) {
+			// Decode frame containing the offset right away, and skip to the offset
+			data, err := zr.decodeFrame(i)
+			if err != nil {
+				return 0, err
+			}
+
+			zr.current = data[offset-zr.frames[i].decompressedOffset:]
+			zr.startPipeline(i + 1)
+		}
+	}
+
+	return offset, nil
+}
+
+// Close stops all decoding and closes the underlying stream, if applicable.
+func (zr *SeekableZStdReader) Close() error {
+	zr.stopPipeline()
+	zr.decoder.Close()
+
+	if zr.closer != nil {
+		return zr.closer.Close()
+	}
+
+	return nil
+}
+
+// findFrame returns the index of the frame containing the decompressed offset off, or the number of frames if
+// the offset lies beyond the end of the stream.
+func (zr *SeekableZStdReader) findFrame(off int64) int {
+	return sort.Search(len(zr.frames), func(i int) bool {
+		return zr.frames[i].decompressedOffset+zr.frames[i].decompressedSize > off
+	})
+}
+
+// decodeFrame decodes the frame with index i.
+func (zr *SeekableZStdReader) decodeFrame(i int) ([]byte, error) {
+	f := zr.frames[i]
+
+	// Read compressed frame
+	buf := make([]byte, f.compressedSize)
+
+	_, err := zr.ra.ReadAt(buf, f.compressedOffset)
+	if err != nil {
+		return nil, fmt.Errorf("read ZStd frame [frame=%d]: %w", i, err)
+	}
+
+	// Decode frame
+	data, err := zr.decoder.DecodeAll(buf, make([]byte, 0, f.decompressedSize))
+	if err != nil {
+		return nil, fmt.Errorf("decode ZStd frame [frame=%d]: %w", i, err)
+	}
+
+	if int64(len(data)) != f.decompressedSize {
+		return nil, fmt.Errorf("unexpected ZStd frame size [frame=%d, size=%d]", i, len(data))
+	}
+
+	return data, nil
+}
+
+// startPipeline starts decoding frames, in parallel, starting at frame index start. Results are delivered in
+// order via zr.results.
+func (zr *SeekableZStdReader) startPipeline(start int) {
+	results := make(chan chan *zstdFrameResult, zr.concurrency)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(results)
+
+		for i := start; i < len(zr.frames); i++ {
+			// Queue up result channel, this will block if too many frames are in flight
+			res := make(chan *zstdFrameResult, 1)
+
+			select {
+			case results <- res:
+			case <-stop:
+				return
+			}
+
+			// Decode frame in the background
+			go func(i int) {
+				data, err := zr.decodeFrame(i)
+				res <- &zstdFrameResult{data: data, err: err}
+			}(i)
+		}
+	}()
+
+	zr.results, zr.stop = results, stop
+}
+
+// stopPipeline stops the decoding pipeline, if it is running.
+func (zr *SeekableZStdReader) stopPipeline() {
+	if zr.stop != nil {
+		close(zr.stop)
+	}
+
+	zr.results, zr.stop = nil, nil
+}
+
+// readZStdSeekTable reads the seek table at the end of the seekable ZStd stream ra of the given size, with the
+// first frame starting at offset start (following a custom dictionary, if any).
+func readZStdSeekTable(ra io.ReaderAt, start int64, size int64) ([]zstdFrame, error) {
+	// Read footer
+	if size < zstdSkippableFrameHeaderSize+zstdSeekTableFooterSize {
+		return nil, ErrNotSeekableZStd
+	}
+
+	var footer [zstdSeekTableFooterSize]byte
+
+	_, err := ra.ReadAt(footer[:], size-zstdSeekTableFooterSize)
+	if err != nil {
+		return nil, fmt.Errorf("read ZStd seek table footer: %w", err)
+	}
+
+	if string(footer[5:9]) != magicZStdSeekTableFooter {
+		return nil, ErrNotSeekableZStd
+	}
+
+	numFrames := int64(binary.LittleEndian.Uint32(footer[0:4]))
+	descriptor := footer[4]
+
+	// Compute size of the seek table
+	entrySize := int64(8)
+	if descriptor&zstdSeekTableChecksumFlag != 0 {
+		entrySize = 12
+	}
+
+	tableSize := numFrames*entrySize + zstdSeekTableFooterSize
+	tableOffset := size - tableSize - zstdSkippableFrameHeaderSize
+
+	if tableOffset < 0 {
+		return nil, fmt.Errorf("invalid ZStd seek table size [frames=%d]", numFrames)
+	}
+
+	// Read skippable frame header and seek table entries
+	table := make([]byte, zstdSkippableFrameHeaderSize+numFrames*entrySize)
+
+	_, err = ra.ReadAt(table, tableOffset)
+	if err != nil {
+		return nil, fmt.Errorf("read ZStd seek table: %w", err)
+	}
+
+	if (string(table[0:4]) != magicZStdSeekTableFrame) || (int64(binary.LittleEndian.Uint32(table[4:8])) != tableSize) {
+		return nil, errors.New("invalid ZStd seek table frame header")
+	}
+
+	// Parse entries
+	frames := make([]zstdFrame, 0, numFrames)
+
+	var compressedOffset, decompressedOffset int64
+
+	for e := table[zstdSkippableFrameHeaderSize:]; len(e) > 0; e = e[entrySize:] {
+		f := zstdFrame{
+			compressedOffset:   compressedOffset,
+			compressedSize:     int64(binary.LittleEndian.Uint32(e[0:4])),
+			decompressedOffset: decompressedOffset,
+			decompressedSize:   int64(binary.LittleEndian.Uint32(e[4:8])),
+		}
+
+		compressedOffset += f.compressedSize
+		decompressedOffset += f.decompressedSize
+
+		frames = append(frames, f)
+	}
+
+	// Frames must cover everything up to the seek table. A leading custom dictionary is either not listed, or
+	// listed as a frame without content.
+	switch {
+	case compressedOffset == tableOffset-start:
+		for i := range frames {
+			frames[i].compressedOffset += start
+		}
+
+	case (start > 0) && (compressedOffset == tableOffset) && (frames[0].compressedSize == start) && (frames[0].decompressedSize == 0):
+		frames = frames[1:]
+
+	default:
+		return nil, errors.New("ZStd seek table does not match stream size")
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,280 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// seekableZStdOptions describes how a seekable ZStd stream is built for tests.
+type seekableZStdOptions struct {
+	dict      bool // Prepend a custom dictionary in a skippable frame (like megawarc)
+	listDict  bool // List the dictionary frame in the seek table, as a frame without content
+	checksums bool // Add checksums to the seek table entries
+}
+
+// testZStdDict returns a ZStd dictionary for tests.
+func testZStdDict(t *testing.T) []byte {
+	t.Helper()
+
+	history := []byte(strings.Repeat("WARC/1.0\r\nWARC-Type: response\r\nContent-Type: text/html\r\n", 64))
+
+	var samples [][]byte
+
+	for i := range 64 {
+		samples = append(samples, []byte(fmt.Sprintf("WARC-Record-ID: <urn:uuid:%08x>\r\nContent-Length: %d\r\n", i*7919, i*31)))
+	}
+
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       1234,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dict
+}
+
+// buildSeekableZStd returns a seekable ZStd stream with one frame per given content.
+func buildSeekableZStd(t *testing.T, contents []string, opts seekableZStdOptions) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var entries [][2]uint32
+
+	// Write custom dictionary, ZStd compressed in a skippable frame
+	var encOpts []zstd.EOption
+
+	if opts.dict {
+		dict := testZStdDict(t)
+		encOpts = append(encOpts, zstd.WithEncoderDict(dict))
+
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compressed := enc.EncodeAll(dict, nil)
+		enc.Close()
+
+		buf.WriteString("\x5d" + magicZStdSkippableFrame)
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(compressed))))
+		buf.Write(compressed)
+
+		if opts.listDict {
+			entries = append(entries, [2]uint32{uint32(buf.Len()), 0})
+		}
+	}
+
+	// Write one frame per content
+	enc, err := zstd.NewWriter(nil, encOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer enc.Close()
+
+	for _, c := range contents {
+		frame := enc.EncodeAll([]byte(c), nil)
+
+		buf.Write(frame)
+		entries = append(entries, [2]uint32{uint32(len(frame)), uint32(len(c))})
+	}
+
+	// Write seek table
+	var table []byte
+
+	for _, e := range entries {
+		table = binary.LittleEndian.AppendUint32(table, e[0])
+		table = binary.LittleEndian.AppendUint32(table, e[1])
+
+		if opts.checksums {
+			table = binary.LittleEndian.AppendUint32(table, 0)
+		}
+	}
+
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(entries)))
+
+	if opts.checksums {
+		table = append(table, zstdSeekTableChecksumFlag)
+	} else {
+		table = append(table, 0)
+	}
+
+	table = append(table, magicZStdSeekTableFooter...)
+
+	buf.WriteString(magicZStdSeekTableFrame)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(table))))
+	buf.Write(table)
+
+	return buf.Bytes()
+}
+
+// TestSeekableZStdReader tests reading, seeking and reading at offsets of seekable ZStd streams.
+func TestSeekableZStdReader(t *testing.T) {
+	contents := []string{
+		strings.Repeat("WARC/1.0\r\nWARC-Type: response\r\n", 10),
+		"",
+		strings.Repeat("Content-Type: text/html\r\n", 20),
+		"last frame",
+	}
+
+	full := strings.Join(contents, "")
+
+	tests := []struct {
+		name     string
+		contents []string
+		opts     seekableZStdOptions
+	}{
+		{name: "plain", contents: contents},
+		{name: "checksums", contents: contents, opts: seekableZStdOptions{checksums: true}},
+		{name: "empty", contents: nil},
+		{name: "single frame", contents: []string{full}},
+		{name: "dictionary", contents: contents, opts: seekableZStdOptions{dict: true}},
+		{name: "listed dictionary", contents: contents, opts: seekableZStdOptions{dict: true, listDict: true}},
+		{name: "dictionary without frames", contents: nil, opts: seekableZStdOptions{dict: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildSeekableZStd(t, tt.contents, tt.opts)
+			want := strings.Join(tt.contents, "")
+
+			zr, err := NewSeekableZStdReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("NewSeekableZStdReader() error = %v", err)
+			}
+
+			defer zr.Close()
+
+			if zr.Size() != int64(len(want)) {
+				t.Errorf("Size() = %d, want %d", zr.Size(), len(want))
+			}
+
+			// Read everything
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+
+			if string(got) != want {
+				t.Errorf("ReadAll() = %q, want %q", got, want)
+			}
+
+			// Seek into the middle and read the rest
+			off := int64(len(want) / 3)
+
+			pos, err := zr.Seek(off, io.SeekStart)
+			if (err != nil) || (pos != off) {
+				t.Fatalf("Seek() = %d, %v, want %d", pos, err, off)
+			}
+
+			got, err = io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("ReadAll() after Seek() error = %v", err)
+			}
+
+			if string(got) != want[off:] {
+				t.Errorf("ReadAll() after Seek() = %q, want %q", got, want[off:])
+			}
+
+			// Read across frame boundaries at an offset
+			if len(want) > 0 {
+				p := make([]byte, len(want)-int(off)/2)
+
+				n, err := zr.ReadAt(p, off/2)
+				if (err != nil) || (string(p[:n]) != want[off/2:]) {
+					t.Errorf("ReadAt() = %q, %v, want %q", p[:n], err, want[off/2:])
+				}
+			}
+		})
+	}
+}
+
+// TestReadZStdSeekTable tests parsing of invalid ZStd seek tables.
+func TestReadZStdSeekTable(t *testing.T) {
+	valid := buildSeekableZStd(t, []string{"first", "second"}, seekableZStdOptions{})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "too short", data: []byte("short"), wantErr: ErrNotSeekableZStd},
+		{name: "no seek table", data: valid[:len(valid)-1], wantErr: ErrNotSeekableZStd},
+		{name: "frames missing", data: valid[len(valid)/2:]},
+		{name: "frames prepended", data: append([]byte("junk"), valid...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readZStdSeekTable(bytes.NewReader(tt.data), 0, int64(len(tt.data)))
+			if err == nil {
+				t.Fatalf("readZStdSeekTable() error = nil, want error")
+			}
+
+			if (tt.wantErr != nil) && !errors.Is(err, tt.wantErr) {
+				t.Errorf("readZStdSeekTable() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestDecompressZStdCustomDict tests decoding ZStd streams with a prepended custom dictionary, both seekable
+// and sequentially.
+func TestDecompressZStdCustomDict(t *testing.T) {
+	contents := []string{strings.Repeat("WARC/1.0\r\nWARC-Type: response\r\n", 10), "last frame"}
+	data := buildSeekableZStd(t, contents, seekableZStdOptions{dict: true})
+
+	tests := []struct {
+		name     string
+		r        io.ReadCloser
+		seekable bool
+	}{
+		{name: "seekable", r: nopReadSeekCloser{bytes.NewReader(data)}, seekable: true},
+		{name: "sequential", r: io.NopCloser(bytes.NewReader(data))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dr, err := NewDecompressionReader(tt.r)
+			if err != nil {
+				t.Fatalf("NewDecompressionReader() error = %v", err)
+			}
+
+			defer dr.Close()
+
+			if _, ok := dr.(*SeekableZStdReader); ok != tt.seekable {
+				t.Errorf("NewDecompressionReader() seekable = %t, want %t", ok, tt.seekable)
+			}
+
+			got, err := io.ReadAll(dr)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+
+			if want := strings.Join(contents, ""); string(got) != want {
+				t.Errorf("ReadAll() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// nopReadSeekCloser adds a no-op Close method to a bytes.Reader.
+type nopReadSeekCloser struct {
+	*bytes.Reader
+}
+
+// Close does nothing.
+func (nopReadSeekCloser) Close() error {
+	return nil
+}
@@ -2,6 +2,7 @@ package mime
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/gabriel-vasile/mimetype"
 )
@@ -12,27 +13,41 @@ const (
 
 	// textPlainMimeSubtype specifies the mime subtype of "text/plain".
 	textPlainMimeSubtype = "text/plain"
+
+	// jsonMimeType specifies the mime type of "application/json".
+	jsonMimeType = "application/json"
+
+	// jsonMimeSuffix specifies the structured syntax suffix of JSON based mime types (RFC 6839).
+	jsonMimeSuffix = "+json"
 )
 
 var (
-	// isTextCache caches results of calls to IsText.
-	isTextCache = make(map[string]bool)
+	// isTextCache caches results of calls to IsText. It is safe for concurrent use.
+	isTextCache sync.Map
 )
 
 // IsText returns true if the given mime is inherited from "text/plain".
 func IsText(mime string) bool {
 	// Check cache first
-	if isText, ok := isTextCache[mime]; ok {
-		return isText
+	if isText, ok := isTextCache.Load(mime); ok {
+		return isText.(bool)
 	}
 
 	// Get value bypassing cache
 	it := isTextNoCache(mime)
 
-	isTextCache[mime] = it
+	isTextCache.Store(mime, it)
 	return it
 }
 
+// IsJSON returns true if the given mime is "application/json" or uses the "+json" structured syntax suffix.
+func IsJSON(mime string) bool {
+	// Remove additional information
+	mime = strings.ToLower(strings.TrimSpace(strings.SplitN(mime, ";", 2)[0]))
+
+	return (mime == jsonMimeType) || (strings.HasPrefix(mime, "application/") && strings.HasSuffix(mime, jsonMimeSuffix))
+}
+
 // isTextNoCache returns true if the given mime is inherited from "text/plain". Any cache is ignored.
 func isTextNoCache(mime string) bool {
 	// Remove additional information
@@ -0,0 +1,81 @@
+package warc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WalkJSON walks the JSON document read from r (like the metadata envelopes of WAT files), calling fn with
+// the path and value of each string value, in document order. Paths use dot notation for object keys and
+// brackets for array indexes (e.g. "Envelope.Payload-Metadata.HTTP-Response-Metadata.Links[3].url").
+func WalkJSON(r io.Reader, fn func(path string, value string) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	return walkJSONValue(dec, "", fn)
+}
+
+// walkJSONValue walks the next JSON value read from dec, located at the given path.
+func walkJSONValue(dec *json.Decoder, path string, fn func(path string, value string) error) error {
+	// Read next token
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read JSON token [path=%s]: %w", path, err)
+	}
+
+	switch t := tok.(type) {
+	case string:
+		// String value
+		return fn(path, t)
+
+	case json.Delim:
+		// Object or array
+		for i := 0; dec.More(); i++ {
+			// Extract path of the next element
+			var elemPath string
+
+			if t == '{' {
+				kt, err := dec.Token()
+				if err != nil {
+					return fmt.Errorf("read JSON object key [path=%s]: %w", path, err)
+				}
+
+				key, _ := kt.(string)
+				elemPath = jsonPathKey(path, key)
+			} else {
+				elemPath = path + "[" + strconv.Itoa(i) + "]"
+			}
+
+			// Walk element
+			err = walkJSONValue(dec, elemPath, fn)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Consume closing delimiter
+		_, err = dec.Token()
+		if err != nil {
+			return fmt.Errorf("read JSON token [path=%s]: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// jsonPathKey appends the object key to the given path. Keys that would be ambiguous in dot notation are
+// quoted in brackets.
+func jsonPathKey(path string, key string) string {
+	if (key == "") || strings.ContainsAny(key, `."[] `) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
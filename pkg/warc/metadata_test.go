@@ -0,0 +1,113 @@
+package warc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestWalkJSON tests walking the string values of JSON documents.
+func TestWalkJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    []string // Path and value of each string value, separated by "="
+		wantErr bool
+	}{
+		{name: "string", doc: `"value"`, want: []string{"=value"}},
+		{name: "flat object", doc: `{"a":"1","b":"2"}`, want: []string{"a=1", "b=2"}},
+		{
+			name: "nested objects",
+			doc:  `{"Envelope":{"Payload-Metadata":{"HTTP-Response-Metadata":{"Server":"nginx"}}}}`,
+			want: []string{"Envelope.Payload-Metadata.HTTP-Response-Metadata.Server=nginx"},
+		},
+		{
+			name: "arrays",
+			doc:  `{"Links":[{"url":"/a"},{"url":"/b","text":"B"}],"tags":["x",["y"]]}`,
+			want: []string{"Links[0].url=/a", "Links[1].url=/b", "Links[1].text=B", "tags[0]=x", "tags[1][0]=y"},
+		},
+		{name: "top-level array", doc: `["a",{"b":"c"}]`, want: []string{"[0]=a", "[1].b=c"}},
+		{
+			name: "keys needing escaping",
+			doc:  `{"a.b":"1","c[0]":"2","d e":"3","":"4","f\"g":"5","h":{"i.j":{"k":"6"}}}`,
+			want: []string{`["a.b"]=1`, `["c[0]"]=2`, `["d e"]=3`, `[""]=4`, `["f\"g"]=5`, `h["i.j"].k=6`},
+		},
+		{
+			name: "non-string values",
+			doc:  `{"n":12345678901234567890,"f":1.5,"b":true,"z":null,"o":{},"a":[],"s":"kept"}`,
+			want: []string{"s=kept"},
+		},
+		{name: "escaped string", doc: `{"s":"line\nbreak é"}`, want: []string{"s=line\nbreak é"}},
+		{name: "empty document", doc: ``, wantErr: true},
+		{name: "truncated object", doc: `{"a":"1",`, want: []string{"a=1"}, wantErr: true},
+		{name: "truncated string", doc: `{"a":"1`, wantErr: true},
+		{name: "invalid token", doc: `{"a":nope}`, wantErr: true},
+		{name: "missing colon", doc: `{"a" "1"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			err := WalkJSON(strings.NewReader(tt.doc), func(path string, value string) error {
+				got = append(got, path+"="+value)
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalkJSON() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WalkJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWalkJSONCallbackError tests that errors of the callback abort walking.
+func TestWalkJSONCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+
+	err := WalkJSON(strings.NewReader(`["a","b","c"]`), func(path string, value string) error {
+		calls++
+		return errStop
+	})
+
+	if !errors.Is(err, errStop) {
+		t.Errorf("WalkJSON() error = %v, want %v", err, errStop)
+	}
+
+	if calls != 1 {
+		t.Errorf("WalkJSON() called callback %d times, want 1", calls)
+	}
+}
+
+// TestJSONPathKey tests appending object keys to JSON paths.
+func TestJSONPathKey(t *testing.T) {
+	tests := []struct {
+		path string
+		key  string
+		want string
+	}{
+		{path: "", key: "a", want: "a"},
+		{path: "a", key: "b", want: "a.b"},
+		{path: "a[0]", key: "Content-Type", want: "a[0].Content-Type"},
+		{path: "", key: "", want: `[""]`},
+		{path: "a", key: "b.c", want: `a["b.c"]`},
+		{path: "a", key: "[0]", want: `a["[0]"]`},
+		{path: "a", key: "b c", want: `a["b c"]`},
+		{path: "a", key: `b"c`, want: `a["b\"c"]`},
+		{path: "a", key: "b\nc", want: `a.b` + "\n" + `c`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := jsonPathKey(tt.path, tt.key); got != tt.want {
+				t.Errorf("jsonPathKey(%q, %q) = %q, want %q", tt.path, tt.key, got, tt.want)
+			}
+		})
+	}
+}
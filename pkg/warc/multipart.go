@@ -0,0 +1,114 @@
+package warc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+const (
+	// multipartMimeType specifies the mime type family of "multipart".
+	multipartMimeType = "multipart"
+
+	// defaultPartContentType is the content type of parts that don't specify one (RFC 2046, section 5.1).
+	defaultPartContentType = "text/plain"
+
+	// Headers
+	contentRangeHeader = "Content-Range"
+)
+
+// Part contains all information about a single part of a multipart HTTP message.
+type Part struct {
+	Index       int       // Index of the part within the multipart body, starting at 0
+	Name        string    // Form field name, file name, or content range of the part (if any)
+	ContentType string    // Content type of the part
+	Content     io.Reader // Reader for the content of the part
+}
+
+// IsMultipart returns true if the given HTTP content type describes a multipart body (e.g. "multipart/mixed",
+// "multipart/form-data", or "multipart/byteranges").
+func IsMultipart(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, multipartMimeType+"/")
+}
+
+// TraverseMultipart will traverse the parts of the multipart HTTP message read from r (including the HTTP
+// header, as provided by Record.Content), calling fn for each part. The boundary is taken from the given HTTP
+// content type.
+func TraverseMultipart(r io.Reader, contentType string, fn func(p *Part) error) error {
+	// Extract boundary
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("parse multipart content type: %w", err)
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("multipart boundary is missing")
+	}
+
+	// Skip HTTP header
+	br := bufio.NewReader(r)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("skip HTTP header: %w", err)
+		}
+
+		if strings.TrimRight(line, "\r\n") == "" {
+			break
+		}
+	}
+
+	// Iterate parts
+	mr := multipart.NewReader(br, boundary)
+
+	for i := 0; ; i++ {
+		mp, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("read multipart part [index=%d]: %w", i, err)
+		}
+
+		// Determine name of the part
+		name := mp.FormName()
+
+		if filename := mp.FileName(); filename != "" {
+			name = filename
+		} else if cr := mp.Header.Get(contentRangeHeader); (name == "") && (cr != "") {
+			name = cr
+		}
+
+		// Determine content type of the part
+		ct := mp.Header.Get(contentTypeHeader)
+		if ct == "" {
+			ct = defaultPartContentType
+		}
+
+		// Call part
+		err = fn(&Part{
+			Index:       i,
+			Name:        name,
+			ContentType: ct,
+			Content:     mp,
+		})
+
+		if err != nil {
+			return fmt.Errorf("callback: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package warc
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestIsMultipart tests detecting multipart content types.
+func TestIsMultipart(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "multipart/byteranges; boundary=3d6b6a416f9b5", want: true},
+		{contentType: "multipart/form-data; boundary=x", want: true},
+		{contentType: "Multipart/Mixed; boundary=x", want: true},
+		{contentType: "text/html; charset=utf-8", want: false},
+		{contentType: "multipart", want: false},
+		{contentType: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := IsMultipart(tt.contentType); got != tt.want {
+				t.Errorf("IsMultipart(%q) = %t, want %t", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTraverseMultipart tests traversing the parts of multipart HTTP messages.
+func TestTraverseMultipart(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		message     string
+		want        []Part // Expected parts, without content
+		wantContent []string
+		wantErr     bool
+	}{
+		{
+			name:        "byte ranges",
+			contentType: "multipart/byteranges; boundary=3d6b6a416f9b5",
+			message: "HTTP/1.1 206 Partial Content\r\n" +
+				"Content-Type: multipart/byteranges; boundary=3d6b6a416f9b5\r\n" +
+				"\r\n" +
+				"--3d6b6a416f9b5\r\n" +
+				"Content-Type: text/html\r\n" +
+				"Content-Range: bytes 0-9/100\r\n" +
+				"\r\n" +
+				"<html>abc\r\n" +
+				"--3d6b6a416f9b5\r\n" +
+				"Content-Range: bytes 90-99/100\r\n" +
+				"\r\n" +
+				"token=xyz\r\n" +
+				"--3d6b6a416f9b5--\r\n",
+			want: []Part{
+				{Index: 0, Name: "bytes 0-9/100", ContentType: "text/html"},
+				{Index: 1, Name: "bytes 90-99/100", ContentType: "text/plain"},
+			},
+			wantContent: []string{"<html>abc", "token=xyz"},
+		},
+		{
+			name:        "form data",
+			contentType: `multipart/form-data; boundary="b"`,
+			message: "HTTP/1.1 200 OK\n" +
+				"\n" +
+				"--b\r\n" +
+				"Content-Disposition: form-data; name=\"field\"\r\n" +
+				"\r\n" +
+				"value\r\n" +
+				"--b\r\n" +
+				"Content-Disposition: form-data; name=\"upload\"; filename=\"secret.env\"\r\n" +
+				"Content-Type: application/octet-stream\r\n" +
+				"\r\n" +
+				"KEY=1\r\n" +
+				"--b--\r\n",
+			want: []Part{
+				{Index: 0, Name: "field", ContentType: "text/plain"},
+				{Index: 1, Name: "secret.env", ContentType: "application/octet-stream"},
+			},
+			wantContent: []string{"value", "KEY=1"},
+		},
+		{
+			name:        "no parts",
+			contentType: "multipart/mixed; boundary=b",
+			message:     "HTTP/1.1 200 OK\r\n\r\n--b--\r\n",
+		},
+		{
+			name:        "missing boundary",
+			contentType: "multipart/mixed",
+			message:     "HTTP/1.1 200 OK\r\n\r\n",
+			wantErr:     true,
+		},
+		{
+			name:        "truncated header",
+			contentType: "multipart/mixed; boundary=b",
+			message:     "HTTP/1.1 200 OK\r\n",
+			wantErr:     true,
+		},
+		{
+			name:        "truncated part",
+			contentType: "multipart/mixed; boundary=b",
+			message:     "HTTP/1.1 200 OK\r\n\r\n--b\r\n\r\ncontent",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Part
+			var contents []string
+
+			err := TraverseMultipart(strings.NewReader(tt.message), tt.contentType, func(p *Part) error {
+				content, err := io.ReadAll(p.Content)
+				if err != nil {
+					return err
+				}
+
+				got = append(got, Part{Index: p.Index, Name: p.Name, ContentType: p.ContentType})
+				contents = append(contents, string(content))
+
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TraverseMultipart() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TraverseMultipart() parts = %+v, want %+v", got, tt.want)
+			}
+
+			if !reflect.DeepEqual(contents, tt.wantContent) {
+				t.Errorf("TraverseMultipart() contents = %q, want %q", contents, tt.wantContent)
+			}
+		})
+	}
+}
+
+// TestTraverseMultipartCallbackError tests that errors of the callback abort traversing.
+func TestTraverseMultipartCallbackError(t *testing.T) {
+	message := "HTTP/1.1 200 OK\r\n\r\n--b\r\n\r\nfirst\r\n--b\r\n\r\nsecond\r\n--b--\r\n"
+	errStop := errors.New("stop")
+
+	calls := 0
+
+	err := TraverseMultipart(strings.NewReader(message), "multipart/mixed; boundary=b", func(p *Part) error {
+		calls++
+		return errStop
+	})
+
+	if !errors.Is(err, errStop) {
+		t.Errorf("TraverseMultipart() error = %v, want %v", err, errStop)
+	}
+
+	if calls != 1 {
+		t.Errorf("TraverseMultipart() called callback %d times, want 1", calls)
+	}
+}
@@ -3,6 +3,7 @@ package warc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -43,17 +44,48 @@ const (
 type Record struct {
 	Type                  string    // Type of record ("request", "response", or "metadata")
 	TargetURI             string    // Target URI of the record
+	ContentType           string    // Content type of the record content (e.g. "application/http")
 	IdentifiedPayloadType string    // Identified MIME type of the payload
-	HTTPContentType       string    // Content type defined by HTTP header
+	HTTPContentType       string    // Content type defined by HTTP header (empty if not an HTTP record)
 	Content               io.Reader // Reader for the content
 }
 
-// Traverse will traverse the stream via r, calling fn for each record.
-func Traverse(r io.Reader, fn func(r *Record) error) error {
+// traverseParams wraps all parameters of Traverse.
+type traverseParams struct {
+	allRecords bool
+}
+
+// TraverseOption is an option of Traverse.
+type TraverseOption func(*traverseParams)
+
+// WithAllRecords makes Traverse call back for records of all types and content types (like metadata, resource,
+// or warcinfo records), instead of only for HTTP records.
+func WithAllRecords() TraverseOption {
+	return func(p *traverseParams) {
+		p.allRecords = true
+	}
+}
+
+// Traverse will traverse the stream via r, calling fn for each HTTP record (with content type
+// "application/http"), or for each record if WithAllRecords is given. For HTTP records, the HTTP content type is
+// extracted and the content still contains the full HTTP message, including the header. Traversal stops with an
+// error once the context is canceled.
+func Traverse(ctx context.Context, r io.Reader, fn func(r *Record) error, opts ...TraverseOption) error {
+	params := &traverseParams{}
+
+	for _, opt := range opts {
+		opt(params)
+	}
+
 	// Buffered IO
 	br := bufio.NewReaderSize(r, bufferSize)
 
 	for {
+		// Bail if canceled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Parse WARC header
 		warcHeader, err := parseWARCHeader(br)
 		if err == io.EOF {
@@ -70,10 +102,21 @@ func Traverse(r io.Reader, fn func(r *Record) error) error {
 			return fmt.Errorf("read record content length: %w", err)
 		}
 
-		// Extract HTTP headers
+		// Prepare record
 		lr := io.LimitReader(br, int64(length))
 
-		if strings.HasPrefix(warcHeader[contentTypeHeader], "application/http") {
+		record := &Record{
+			Type:                  warcHeader[warcTypeHeader],
+			TargetURI:             warcHeader[warcTargetURIHeader],
+			ContentType:           warcHeader[contentTypeHeader],
+			IdentifiedPayloadType: warcHeader[warcIdentifiedPayloadTypeHeader],
+			Content:               lr,
+		}
+
+		// Extract HTTP headers, if this is an HTTP record
+		isHTTP := strings.HasPrefix(record.ContentType, "application/http")
+
+		if isHTTP {
 			// We want to read the HTTP header, but also want to pass a reader of the full record (including
 			// the HTTP header) into the callback. To achieve this, we create TeeReader tr, which reads from lr
 			// but also writes everything that was read into a buffer buf. Then we create MultiReader mr that
@@ -90,15 +133,13 @@ func Traverse(r io.Reader, fn func(r *Record) error) error {
 				return fmt.Errorf("parse HTTP header: %w", err)
 			}
 
-			// Call record
-			err = fn(&Record{
-				Type:                  warcHeader[warcTypeHeader],
-				TargetURI:             warcHeader[warcTargetURIHeader],
-				IdentifiedPayloadType: warcHeader[warcIdentifiedPayloadTypeHeader],
-				HTTPContentType:       httpHeader[httpContentTypeHeader],
-				Content:               mr,
-			})
+			record.HTTPContentType = httpHeader[httpContentTypeHeader]
+			record.Content = mr
+		}
 
+		// Call record, if requested
+		if isHTTP || params.allRecords {
+			err = fn(record)
 			if err != nil {
 				if errors.Is(err, ErrBreakTraversal) {
 					// Don't report an error if break was requested
@@ -0,0 +1,76 @@
+package warc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testRecord returns a WARC record of the given type, content type, and content.
+func testRecord(typ string, contentType string, content string) string {
+	return "WARC/1.0\r\n" +
+		"WARC-Type: " + typ + "\r\n" +
+		"WARC-Target-URI: https://example.com/\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(content)) + "\r\n" +
+		"\r\n" +
+		content +
+		"\r\n\r\n"
+}
+
+// TestTraverse tests which records Traverse calls back for, with and without WithAllRecords.
+func TestTraverse(t *testing.T) {
+	stream := testRecord("warcinfo", "application/warc-fields", "software: test\r\n") +
+		testRecord(RecordTypeRequest, "application/http; msgtype=request", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n") +
+		testRecord(RecordTypeResponse, "application/http; msgtype=response", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html>") +
+		testRecord(RecordTypeMetadata, "application/json", `{"key":"value"}`) +
+		testRecord("resource", "text/plain", "resource")
+
+	tests := []struct {
+		name string
+		opts []TraverseOption
+		want []string // Type and HTTP content type of the records called back for
+	}{
+		{
+			name: "HTTP records",
+			want: []string{"request|", "response|text/html"},
+		},
+		{
+			name: "all records",
+			opts: []TraverseOption{WithAllRecords()},
+			want: []string{"warcinfo|", "request|", "response|text/html", "metadata|", "resource|"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			err := Traverse(context.Background(), strings.NewReader(stream), func(r *Record) error {
+				// HTTP records still contain the full HTTP message
+				content, err := io.ReadAll(r.Content)
+				if err != nil {
+					return err
+				}
+
+				if (r.Type == RecordTypeResponse) && (string(content) != "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html>") {
+					t.Errorf("Traverse() response content = %q", content)
+				}
+
+				got = append(got, r.Type+"|"+r.HTTPContentType)
+				return nil
+			}, tt.opts...)
+
+			if err != nil {
+				t.Fatalf("Traverse() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Traverse() called back for %q, want %q", got, tt.want)
+			}
+		})
+	}
+}